@@ -0,0 +1,454 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"grpctutorial/pkg/greeterclient"
+	hellopb "grpctutorial/pkg/grpc"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ベンチマークの設定
+type benchConfig struct {
+	rpc            string
+	concurrency    int
+	connections    int
+	requests       int
+	duration       time.Duration
+	qps            float64
+	nameSize       int
+	streamMessages int
+	streamInterval time.Duration
+	report         string
+	reportFormat   string
+}
+
+// 1回のRPCを実行する関数
+type benchCall func(ctx context.Context, client hellopb.GreetingServiceClient) error
+
+// client bench -rpc hello -concurrency 10 -requests 1000
+func runBench(args []string) error {
+	var common commonFlags
+	var cfg benchConfig
+	fs := newFlagSet("bench", "Drive one RPC with concurrent workers and report throughput, latency percentiles and errors.\nRuns until -requests calls are made, or for -duration when it is set. Ctrl-C stops early and still reports.")
+	common.register(fs, "")
+	fs.StringVar(&cfg.rpc, "rpc", "hello", "RPC to call: hello, server-stream, client-stream or bidi")
+	fs.IntVar(&cfg.concurrency, "concurrency", 10, "number of workers calling the RPC in parallel")
+	fs.IntVar(&cfg.connections, "connections", 1, "number of connections shared by the workers")
+	fs.IntVar(&cfg.requests, "requests", 1000, "total number of calls (ignored when -duration is set)")
+	fs.DurationVar(&cfg.duration, "duration", 0, "run for this long instead of a fixed number of calls")
+	fs.Float64Var(&cfg.qps, "qps", 0, "target calls per second across all workers (0 means as fast as possible)")
+	fs.IntVar(&cfg.nameSize, "name-size", 16, "size in bytes of the name sent in each request")
+	fs.IntVar(&cfg.streamMessages, "stream-messages", 5, "messages per call for the streaming RPCs")
+	fs.DurationVar(&cfg.streamInterval, "stream-interval", 10*time.Millisecond, "interval requested from HelloServerStream")
+	fs.StringVar(&cfg.report, "report", "", "also write the report to this file")
+	fs.StringVar(&cfg.reportFormat, "report-format", "", "format of -report: json or csv (default from the file extension; csv rows are appended)")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if err := cfg.validate(); err != nil {
+		fmt.Fprintln(fs.Output(), err)
+		fs.Usage()
+		return errUsage
+	}
+	call, err := cfg.call()
+	if err != nil {
+		return err
+	}
+
+	//接続をまとめて作っておく
+	clients := make([]hellopb.GreetingServiceClient, cfg.connections)
+	for i := range clients {
+		client, closeConn, err := common.connect("")
+		if err != nil {
+			return err
+		}
+		defer closeConn()
+		clients[i] = client.RPC()
+	}
+
+	//Ctrl-Cで止めてもそれまでの結果を出力する
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if cfg.duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.duration)
+		defer cancel()
+	}
+
+	result := cfg.run(ctx, clients, func(client hellopb.GreetingServiceClient) error {
+		//RPC毎のコンテキストは-durationの終了で実行中の呼び出しが切れないように分けておく
+		rctx, cancel := common.context()
+		defer cancel()
+		return call(rctx, client)
+	})
+
+	report := newBenchReport(&cfg, result)
+	if common.output == "text" {
+		report.writeText(os.Stdout)
+	} else if err := report.writeJSON(os.Stdout); err != nil {
+		return err
+	}
+	if cfg.report != "" {
+		if err := report.save(cfg.report, cfg.reportFormat); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *benchConfig) validate() error {
+	switch {
+	case c.concurrency < 1:
+		return errors.New("-concurrency must be at least 1")
+	case c.connections < 1:
+		return errors.New("-connections must be at least 1")
+	case c.duration == 0 && c.requests < 1:
+		return errors.New("-requests must be at least 1")
+	case c.duration < 0:
+		return errors.New("-duration must not be negative")
+	case !(c.qps >= 0) || math.IsInf(c.qps, 0):
+		return errors.New("-qps must be a finite non-negative number")
+	case c.nameSize < 0:
+		return errors.New("-name-size must not be negative")
+	case c.streamMessages < 1:
+		return errors.New("-stream-messages must be at least 1")
+	}
+	if c.reportFormat == "" {
+		c.reportFormat = "json"
+		if strings.EqualFold(filepath.Ext(c.report), ".csv") {
+			c.reportFormat = "csv"
+		}
+	}
+	if c.reportFormat != "json" && c.reportFormat != "csv" {
+		return fmt.Errorf("unknown -report-format %q (json, csv)", c.reportFormat)
+	}
+	return nil
+}
+
+// -rpcで指定されたRPCを呼ぶ関数を返す
+func (c *benchConfig) call() (benchCall, error) {
+	name := strings.Repeat("x", c.nameSize)
+	req := &hellopb.HelloRequest{Name: name}
+	n := c.streamMessages
+
+	switch c.rpc {
+	case "hello":
+		return func(ctx context.Context, client hellopb.GreetingServiceClient) error {
+			_, err := client.Hello(ctx, req)
+			return err
+		}, nil
+
+	case "server-stream":
+		req := &hellopb.HelloRequest{Name: name, Stream: greeterclient.StreamOptions{Count: uint32(n), Interval: c.streamInterval}.Proto()}
+		return func(ctx context.Context, client hellopb.GreetingServiceClient) error {
+			stream, err := client.HelloServerStream(ctx, req)
+			if err != nil {
+				return err
+			}
+			for {
+				if _, err := stream.Recv(); err != nil {
+					if errors.Is(err, io.EOF) {
+						return nil
+					}
+					return err
+				}
+			}
+		}, nil
+
+	case "client-stream":
+		return func(ctx context.Context, client hellopb.GreetingServiceClient) error {
+			stream, err := client.HelloClientStream(ctx)
+			if err != nil {
+				return err
+			}
+			for i := 0; i < n; i++ {
+				//送信の失敗の理由はCloseAndRecvで分かる
+				if err := stream.Send(req); err != nil {
+					break
+				}
+			}
+			_, err = stream.CloseAndRecv()
+			return err
+		}, nil
+
+	case "bidi":
+		//1つ送って1つ受け取るのを繰り返す
+		return func(ctx context.Context, client hellopb.GreetingServiceClient) error {
+			stream, err := client.HelloBiStreams(ctx)
+			if err != nil {
+				return err
+			}
+			for i := 0; i < n; i++ {
+				if err := stream.Send(req); err != nil {
+					break
+				}
+				if _, err := stream.Recv(); err != nil {
+					return err
+				}
+			}
+			if err := stream.CloseSend(); err != nil {
+				return err
+			}
+			if _, err := stream.Recv(); !errors.Is(err, io.EOF) {
+				return err
+			}
+			return nil
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown -rpc %q (hello, server-stream, client-stream, bidi)", c.rpc)
+}
+
+// ベンチマークの生の結果
+type benchResult struct {
+	elapsed   time.Duration
+	latencies []time.Duration
+	codes     map[codes.Code]int
+}
+
+// ワーカーを起動してctxが終わるか指定回数に達するまでcallを呼ぶ
+func (c *benchConfig) run(ctx context.Context, clients []hellopb.GreetingServiceClient, call func(hellopb.GreetingServiceClient) error) benchResult {
+	var (
+		next   atomic.Int64
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+		result = benchResult{codes: map[codes.Code]int{}}
+	)
+	start := time.Now()
+
+	for w := 0; w < c.concurrency; w++ {
+		wg.Add(1)
+		go func(client hellopb.GreetingServiceClient) {
+			defer wg.Done()
+			var latencies []time.Duration
+			counts := map[codes.Code]int{}
+			for ctx.Err() == nil {
+				i := next.Add(1) - 1
+				if c.duration == 0 && i >= int64(c.requests) {
+					break
+				}
+				//-qpsが指定されていればi番目の呼び出しの予定時刻まで待つ
+				if c.qps > 0 {
+					at := start.Add(time.Duration(float64(i) / c.qps * float64(time.Second)))
+					if !sleepUntil(ctx, at) {
+						break
+					}
+				}
+				t := time.Now()
+				err := call(client)
+				latencies = append(latencies, time.Since(t))
+				counts[status.Code(err)]++
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			result.latencies = append(result.latencies, latencies...)
+			for code, n := range counts {
+				result.codes[code] += n
+			}
+		}(clients[w%len(clients)])
+	}
+	wg.Wait()
+	result.elapsed = time.Since(start)
+	return result
+}
+
+// atまで待つ ctxが先に終わった場合はfalseを返す
+func sleepUntil(ctx context.Context, at time.Time) bool {
+	d := time.Until(at)
+	if d <= 0 {
+		return true
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// ベンチマークの結果をまとめたもの
+// 時間はミリ秒で表す
+type benchReport struct {
+	Time          time.Time      `json:"time"`
+	RPC           string         `json:"rpc"`
+	Concurrency   int            `json:"concurrency"`
+	Connections   int            `json:"connections"`
+	TargetQPS     float64        `json:"target_qps"`
+	NameSize      int            `json:"name_size"`
+	Requests      int            `json:"requests"`
+	Errors        int            `json:"errors"`
+	ElapsedMillis float64        `json:"elapsed_ms"`
+	Throughput    float64        `json:"throughput_rps"`
+	Latency       latencyReport  `json:"latency_ms"`
+	Codes         map[string]int `json:"codes"`
+}
+
+type latencyReport struct {
+	Mean float64 `json:"mean"`
+	P50  float64 `json:"p50"`
+	P90  float64 `json:"p90"`
+	P99  float64 `json:"p99"`
+	Max  float64 `json:"max"`
+}
+
+func newBenchReport(c *benchConfig, r benchResult) *benchReport {
+	report := &benchReport{
+		Time:          time.Now(),
+		RPC:           c.rpc,
+		Concurrency:   c.concurrency,
+		Connections:   c.connections,
+		TargetQPS:     c.qps,
+		NameSize:      c.nameSize,
+		Requests:      len(r.latencies),
+		ElapsedMillis: millis(r.elapsed),
+		Codes:         make(map[string]int, len(r.codes)),
+	}
+	for code, n := range r.codes {
+		report.Codes[code.String()] = n
+		if code != codes.OK {
+			report.Errors += n
+		}
+	}
+	if r.elapsed > 0 {
+		report.Throughput = float64(report.Requests) / r.elapsed.Seconds()
+	}
+
+	if len(r.latencies) > 0 {
+		sort.Slice(r.latencies, func(i, j int) bool { return r.latencies[i] < r.latencies[j] })
+		var total time.Duration
+		for _, l := range r.latencies {
+			total += l
+		}
+		report.Latency = latencyReport{
+			Mean: millis(total / time.Duration(len(r.latencies))),
+			P50:  millis(percentile(r.latencies, 50)),
+			P90:  millis(percentile(r.latencies, 90)),
+			P99:  millis(percentile(r.latencies, 99)),
+			Max:  millis(r.latencies[len(r.latencies)-1]),
+		}
+	}
+	return report
+}
+
+// 昇順に並んだsortedのpパーセンタイル(nearest-rank)
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+func millis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+func (r *benchReport) writeText(w io.Writer) {
+	fmt.Fprintf(w, "rpc:          %s (concurrency %d, connections %d)\n", r.RPC, r.Concurrency, r.Connections)
+	fmt.Fprintf(w, "requests:     %d in %.1fms (%d errors)\n", r.Requests, r.ElapsedMillis, r.Errors)
+	fmt.Fprintf(w, "throughput:   %.1f req/s\n", r.Throughput)
+	fmt.Fprintf(w, "latency:      mean %.3fms  p50 %.3fms  p90 %.3fms  p99 %.3fms  max %.3fms\n",
+		r.Latency.Mean, r.Latency.P50, r.Latency.P90, r.Latency.P99, r.Latency.Max)
+	fmt.Fprintln(w, "status codes:")
+	for _, code := range r.codeNames() {
+		fmt.Fprintf(w, "  %-18s %d\n", code, r.Codes[code])
+	}
+}
+
+func (r *benchReport) writeJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// CSVの列
+var benchCSVHeader = []string{
+	"time", "rpc", "concurrency", "connections", "target_qps", "name_size",
+	"requests", "errors", "elapsed_ms", "throughput_rps",
+	"latency_mean_ms", "latency_p50_ms", "latency_p90_ms", "latency_p99_ms", "latency_max_ms", "codes",
+}
+
+func (r *benchReport) csvRecord() []string {
+	f := func(v float64) string { return strconv.FormatFloat(v, 'f', 3, 64) }
+	codes := make([]string, 0, len(r.Codes))
+	for _, code := range r.codeNames() {
+		codes = append(codes, fmt.Sprintf("%s=%d", code, r.Codes[code]))
+	}
+	return []string{
+		r.Time.Format(time.RFC3339), r.RPC, strconv.Itoa(r.Concurrency), strconv.Itoa(r.Connections), f(r.TargetQPS), strconv.Itoa(r.NameSize),
+		strconv.Itoa(r.Requests), strconv.Itoa(r.Errors), f(r.ElapsedMillis), f(r.Throughput),
+		f(r.Latency.Mean), f(r.Latency.P50), f(r.Latency.P90), f(r.Latency.P99), f(r.Latency.Max), strings.Join(codes, ";"),
+	}
+}
+
+// レポートをファイルに書き出す
+// CSVは実行毎に1行追記するので、前回の結果と比べられる
+func (r *benchReport) save(path, format string) error {
+	if format == "json" {
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		if err := r.writeJSON(f); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	w := csv.NewWriter(f)
+	if info.Size() == 0 {
+		w.Write(benchCSVHeader)
+	}
+	w.Write(r.csvRecord())
+	w.Flush()
+	if err := w.Error(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// ステータスコードの名前を件数の多い順に並べる
+func (r *benchReport) codeNames() []string {
+	names := make([]string, 0, len(r.Codes))
+	for name := range r.Codes {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if r.Codes[names[i]] != r.Codes[names[j]] {
+			return r.Codes[names[i]] > r.Codes[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	return names
+}
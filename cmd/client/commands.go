@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"grpctutorial/pkg/greeterclient"
+	hellopb "grpctutorial/pkg/grpc"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+)
+
+// サブコマンド
+type command struct {
+	name  string
+	usage string
+	run   func(args []string) error
+}
+
+var commands []command
+
+func init() {
+	commands = []command{
+		{"hello", "call Hello once", runHello},
+		{"server-stream", "call HelloServerStream and print every response", runServerStream},
+		{"client-stream", "send names with HelloClientStream", runClientStream},
+		{"bidi", "exchange names with HelloBiStreams", runBidi},
+		{"health", "check or watch the server health", runHealth},
+		{"list", "list services, or the methods of a service, with server reflection", runList},
+		{"describe", "print the definition of a service, method or message", runDescribe},
+		{"call", "invoke any method with JSON request bodies", runCall},
+		{"bench", "load test one of the RPCs and report latency percentiles", runBench},
+		{"repl", "interactive menu", runRepl},
+	}
+}
+
+// サブコマンド用のFlagSetを作る
+// argsにはフラグ以外の引数の説明を指定する
+func newFlagSet(name, usage string, args ...string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		synopsis := strings.Join(append([]string{"client", name, "[flags]"}, args...), " ")
+		fmt.Fprintf(fs.Output(), "usage: %s\n\n%s\n\nflags:\n", synopsis, usage)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// フラグの解析に失敗したことを表すエラー
+// 理由と使い方はFlagSetが出力済み
+var errUsage = errors.New("invalid usage")
+
+// フラグを解析する 余分な引数はエラーにする
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return errUsage
+	}
+	if fs.NArg() > 0 {
+		fmt.Fprintf(fs.Output(), "unexpected arguments: %v\n", fs.Args())
+		fs.Usage()
+		return errUsage
+	}
+	return nil
+}
+
+// client hello --name bob
+func runHello(args []string) error {
+	var common commonFlags
+	fs := newFlagSet("hello", "Call Hello once and print the response.")
+	common.register(fs, "")
+	name := fs.String("name", "", "name to greet")
+	lang := fs.String("lang", "", "greeting language tag such as ja or en (empty uses accept-language or the server default)")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	client, closeConn, err := common.connect(*lang)
+	if err != nil {
+		return err
+	}
+	defer closeConn()
+	ctx, cancel := common.context()
+	defer cancel()
+
+	out := newPrinter(&common, os.Stdout, os.Stderr)
+	var header, trailer metadata.MD
+	res, err := client.RPC().Hello(ctx, &hellopb.HelloRequest{Name: *name, Language: *lang}, grpc.Header(&header), grpc.Trailer(&trailer))
+	out.header(header)
+	if err == nil {
+		out.response(res)
+	}
+	out.trailer(trailer)
+	out.status(err)
+	return err
+}
+
+// client server-stream --name bob --count 3
+func runServerStream(args []string) error {
+	var common commonFlags
+	fs := newFlagSet("server-stream", "Call HelloServerStream and print every response.")
+	common.register(fs, "")
+	name := fs.String("name", "", "name to greet")
+	lang := fs.String("lang", "", "greeting language tag such as ja or en (empty uses accept-language or the server default)")
+	count := fs.Uint("count", 0, "number of messages (0 uses the server default)")
+	interval := fs.Duration("interval", 0, "interval between messages (0 uses the server default)")
+	maxRate := fs.Float64("max-rate", 0, "maximum messages per second (0 uses the server limit)")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	client, closeConn, err := common.connect(*lang)
+	if err != nil {
+		return err
+	}
+	defer closeConn()
+	ctx, cancel := common.context()
+	defer cancel()
+
+	opts := greeterclient.StreamOptions{Count: uint32(*count), Interval: *interval, MaxRate: *maxRate}
+	out := newPrinter(&common, os.Stdout, os.Stderr)
+	stream, err := client.HelloServerStream(ctx, *name, opts)
+	if err != nil {
+		out.status(err)
+		return err
+	}
+	if header, err := stream.Header(); err == nil {
+		out.header(header)
+	}
+	for stream.Next() {
+		out.response(stream.Response())
+	}
+	out.trailer(stream.Trailer())
+	err = stream.Err()
+	out.status(err)
+	return err
+}
+
+// client client-stream --names a,b,c
+// --namesを省略した場合は標準入力から1行1名で読む
+func runClientStream(args []string) error {
+	var common commonFlags
+	fs := newFlagSet("client-stream", "Send names with HelloClientStream and print the single response.\nNames are read from stdin, one per line, when --names is omitted.")
+	common.register(fs, "")
+	names := fs.String("names", "", "comma separated names to send")
+	lang := fs.String("lang", "", "greeting language tag such as ja or en (empty uses accept-language or the server default)")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	client, closeConn, err := common.connect(*lang)
+	if err != nil {
+		return err
+	}
+	defer closeConn()
+	ctx, cancel := common.context()
+	defer cancel()
+
+	out := newPrinter(&common, os.Stdout, os.Stderr)
+	stream, err := client.RPC().HelloClientStream(ctx)
+	if err != nil {
+		out.status(err)
+		return err
+	}
+	err = eachName(*names, os.Stdin, func(name string) error {
+		return stream.Send(&hellopb.HelloRequest{Name: name, Language: *lang})
+	})
+	//送信に失敗した場合もCloseAndRecvでserverからのステータスを受け取る
+	if err != nil && !errors.Is(err, io.EOF) {
+		out.status(err)
+		return err
+	}
+
+	res, err := stream.CloseAndRecv()
+	if header, herr := stream.Header(); herr == nil {
+		out.header(header)
+	}
+	if err == nil {
+		out.response(res)
+	}
+	out.trailer(stream.Trailer())
+	out.status(err)
+	return err
+}
+
+// client bidi --names a,b,c
+// 送信と受信を並行して行い、受信したレスポンスを順に出力する
+func runBidi(args []string) error {
+	var common commonFlags
+	fs := newFlagSet("bidi", "Exchange names with HelloBiStreams and print every response.\nNames are read from stdin, one per line, when --names is omitted.")
+	common.register(fs, "")
+	names := fs.String("names", "", "comma separated names to send")
+	lang := fs.String("lang", "", "greeting language tag such as ja or en (empty uses accept-language or the server default)")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	client, closeConn, err := common.connect(*lang)
+	if err != nil {
+		return err
+	}
+	defer closeConn()
+	ctx, cancel := common.context()
+	defer cancel()
+
+	out := newPrinter(&common, os.Stdout, os.Stderr)
+	stream, err := client.RPC().HelloBiStreams(ctx)
+	if err != nil {
+		out.status(err)
+		return err
+	}
+
+	//送信処理
+	sendErr := make(chan error, 1)
+	go func() {
+		err := eachName(*names, os.Stdin, func(name string) error {
+			return stream.Send(&hellopb.HelloRequest{Name: name, Language: *lang})
+		})
+		//送信に失敗した理由はRecvで受け取るステータスで分かる
+		if err == nil || errors.Is(err, io.EOF) {
+			err = stream.CloseSend()
+		}
+		sendErr <- err
+	}()
+
+	//受信処理
+	err = recvAll(stream, out, func() (proto.Message, error) { return stream.Recv() })
+	if err == nil {
+		err = <-sendErr
+	}
+	out.status(err)
+	return err
+}
+
+// ストリームのヘッダー・全てのレスポンス・トレーラーを出力する
+// 正常に終了した場合はnilを返す
+func recvAll(stream grpc.ClientStream, out printer, recv func() (proto.Message, error)) error {
+	if header, err := stream.Header(); err == nil {
+		out.header(header)
+	}
+	defer func() { out.trailer(stream.Trailer()) }()
+	for {
+		res, err := recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		out.response(res)
+	}
+}
+
+// --namesが指定されていればその名前を、なければrから1行ずつ読んだ名前をfnに渡す
+func eachName(names string, r io.Reader, fn func(name string) error) error {
+	if names != "" {
+		for _, name := range splitNames(names) {
+			if err := fn(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if err := fn(scanner.Text()); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
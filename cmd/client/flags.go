@@ -0,0 +1,278 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"grpctutorial/pkg/certs"
+	"grpctutorial/pkg/chain"
+	Interceptors "grpctutorial/pkg/client/Interceptor"
+	"grpctutorial/pkg/greeterclient"
+	"grpctutorial/pkg/tracing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+)
+
+// 全てのサブコマンドで共通の接続・出力のフラグ
+type commonFlags struct {
+	addr        string
+	dialTimeout time.Duration
+
+	useTLS     bool
+	caFile     string
+	certFile   string
+	keyFile    string
+	serverName string
+
+	token            string
+	interceptors     string
+	keepalive        time.Duration
+	keepaliveTimeout time.Duration
+
+	serviceConfig       string
+	retryAttempts       int
+	retryInitialBackoff time.Duration
+	retryMaxBackoff     time.Duration
+	retryMultiplier     float64
+	retryCodes          string
+	hedgeAttempts       int
+	hedgeDelay          time.Duration
+	hedgeCodes          string
+	traceExporter       string
+	traceFile           string
+
+	headers metadataFlag
+	timeout time.Duration
+	output  outputFlag
+	verbose bool
+}
+
+// defaultInterceptorsには-interceptorsのデフォルト値を指定する
+func (c *commonFlags) register(fs *flag.FlagSet, defaultInterceptors string) {
+	fs.StringVar(&c.addr, "addr", "localhost:8080", "server address")
+	fs.DurationVar(&c.dialTimeout, "dial-timeout", 5*time.Second, "how long to wait for the connection to be established")
+	fs.BoolVar(&c.useTLS, "tls", false, "connect with TLS")
+	fs.StringVar(&c.caFile, "tls-ca", "", "CA bundle used to verify the server certificate (implies -tls)")
+	fs.StringVar(&c.certFile, "tls-cert", "", "client certificate file for mutual TLS (implies -tls)")
+	fs.StringVar(&c.keyFile, "tls-key", "", "client private key file for mutual TLS")
+	fs.StringVar(&c.serverName, "tls-server-name", "", "override the server name used to verify the certificate")
+	fs.StringVar(&c.token, "token", "", "bearer token (API key or JWT) sent with every request")
+	fs.DurationVar(&c.keepalive, "keepalive", 0, "send keepalive pings after this much inactivity (0 disables them)")
+	fs.DurationVar(&c.keepaliveTimeout, "keepalive-timeout", 20*time.Second, "close the connection when a keepalive ping is not answered within this time")
+	fs.StringVar(&c.serviceConfig, "service-config", "", "gRPC service config as JSON, or a path to a JSON file (retryPolicy and hedgingPolicy in methodConfig)")
+	fs.IntVar(&c.retryAttempts, "retry-max-attempts", 0, "retry failed RPCs up to this many attempts in total (0 disables retries)")
+	fs.DurationVar(&c.retryInitialBackoff, "retry-initial-backoff", 100*time.Millisecond, "upper bound of the first retry backoff")
+	fs.DurationVar(&c.retryMaxBackoff, "retry-max-backoff", time.Second, "maximum retry backoff")
+	fs.Float64Var(&c.retryMultiplier, "retry-backoff-multiplier", 2, "growth factor of the retry backoff")
+	fs.StringVar(&c.retryCodes, "retry-codes", "UNAVAILABLE", "comma separated status codes that are retried")
+	fs.IntVar(&c.hedgeAttempts, "hedge-max-attempts", 0, "send Hello up to this many times in parallel and use the first success (0 disables hedging)")
+	fs.DurationVar(&c.hedgeDelay, "hedge-delay", 100*time.Millisecond, "delay before sending the next hedged Hello")
+	fs.StringVar(&c.hedgeCodes, "hedge-codes", "UNAVAILABLE", "comma separated status codes that start the next hedged Hello immediately instead of failing")
+	fs.StringVar(&c.interceptors, "interceptors", defaultInterceptors, "comma separated list of enabled interceptors (e.g. example)")
+	fs.StringVar(&c.traceExporter, "trace", "none", "span exporter: none, stdout or otlp-file (enables the tracing interceptor)")
+	fs.StringVar(&c.traceFile, "trace-file", "", "output file of the otlp-file exporter")
+	fs.Var(&c.headers, "H", "request metadata as `key=value` (repeatable)")
+	fs.DurationVar(&c.timeout, "timeout", 0, "deadline of each RPC (0 means no deadline)")
+	c.output = "text"
+	fs.Var(&c.output, "output", "output `format`: text, json (one object per RPC) or ndjson (one line per header, response, trailer and status)")
+	fs.BoolVar(&c.verbose, "v", false, "also print response headers, trailers and status in the text output")
+}
+
+// フラグに従ってserverに接続する
+// 返り値の関数で接続とトレーサーを閉じる
+func (c *commonFlags) dial() (*grpc.ClientConn, func(), error) {
+	client, closeClient, err := c.connect("")
+	if err != nil {
+		return nil, nil, err
+	}
+	return client.Conn(), closeClient, nil
+}
+
+// フラグに従ってserverに接続し、GreetingServiceのクライアントを作る
+// langはリクエストのlanguageに指定する言語
+// 返り値の関数で接続とトレーサーを閉じる
+func (c *commonFlags) connect(lang string) (*greeterclient.Client, func(), error) {
+	opts := []greeterclient.Option{greeterclient.WithLanguage(lang), greeterclient.WithToken(c.token)}
+	//TLSを使うかどうかでクレデンシャルを切り替える
+	if c.useTLS || c.caFile != "" || c.certFile != "" {
+		tlsConfig, err := certs.ClientConfig(c.caFile, c.certFile, c.keyFile, c.serverName)
+		if err != nil {
+			return nil, nil, err
+		}
+		opts = append(opts, greeterclient.WithTLS(tlsConfig))
+	}
+	if c.keepalive > 0 {
+		opts = append(opts, greeterclient.WithKeepalive(c.keepalive, c.keepaliveTimeout))
+	}
+	policies, err := c.policies()
+	if err != nil {
+		return nil, nil, err
+	}
+	opts = append(opts, policies...)
+
+	//インターセプターを指定された順に並べる トークンはgreeterclientが最後に付与する
+	var specs []chain.Spec
+	for _, name := range strings.Split(c.interceptors, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			specs = append(specs, chain.Spec{Name: name})
+		}
+	}
+	//トレーシングはメッセージを全て記録できるように先頭に置く
+	exporter, err := tracing.NewExporter(c.traceExporter, c.traceFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	tracer := tracing.NewTracer("grpctutorial-client", exporter)
+	if exporter != nil {
+		specs = append([]chain.Spec{{Name: "tracing"}}, specs...)
+	}
+	registry := Interceptors.NewRegistry()
+	registry.Register("tracing", Interceptors.TracingFactory(tracer))
+	interceptors, err := chain.Build(registry, specs)
+	if err != nil {
+		tracer.Close()
+		return nil, nil, err
+	}
+	opts = append(opts, greeterclient.WithInterceptors(interceptors))
+
+	//gRPCserverとのコネクションを確立
+	ctx, cancel := context.WithTimeout(context.Background(), c.dialTimeout)
+	defer cancel()
+	client, err := greeterclient.Dial(ctx, c.addr, opts...)
+	if err != nil {
+		tracer.Close()
+		if errors.Is(err, context.DeadlineExceeded) {
+			return nil, nil, fmt.Errorf("connection to %s failed: timed out after %v", c.addr, c.dialTimeout)
+		}
+		return nil, nil, err
+	}
+	return client, func() {
+		client.Close()
+		tracer.Close()
+	}, nil
+}
+
+// リトライ・ヘッジング・service configのフラグに対応するOption
+func (c *commonFlags) policies() ([]greeterclient.Option, error) {
+	var opts []greeterclient.Option
+	if c.serviceConfig != "" {
+		sc := c.serviceConfig
+		//JSONでなければファイルのパスとして読む
+		if !strings.HasPrefix(strings.TrimSpace(sc), "{") {
+			b, err := os.ReadFile(sc)
+			if err != nil {
+				return nil, err
+			}
+			sc = string(b)
+		}
+		opts = append(opts, greeterclient.WithServiceConfig(sc))
+	}
+	if c.retryAttempts > 0 {
+		retryable, err := parseCodes(c.retryCodes)
+		if err != nil {
+			return nil, fmt.Errorf("-retry-codes: %w", err)
+		}
+		opts = append(opts, greeterclient.WithRetry(greeterclient.RetryPolicy{
+			MaxAttempts:       c.retryAttempts,
+			InitialBackoff:    c.retryInitialBackoff,
+			MaxBackoff:        c.retryMaxBackoff,
+			BackoffMultiplier: c.retryMultiplier,
+			RetryableCodes:    retryable,
+		}))
+	}
+	if c.hedgeAttempts > 0 {
+		nonFatal, err := parseCodes(c.hedgeCodes)
+		if err != nil {
+			return nil, fmt.Errorf("-hedge-codes: %w", err)
+		}
+		opts = append(opts, greeterclient.WithHedging(Interceptors.HedgingPolicy{
+			MaxAttempts:   c.hedgeAttempts,
+			Delay:         c.hedgeDelay,
+			NonFatalCodes: nonFatal,
+		}))
+	}
+	return opts, nil
+}
+
+// RPC毎のコンテキストを作る
+// -timeoutが指定されていれば期限を設定し、-Hで指定されたメタデータを付与する
+func (c *commonFlags) context() (context.Context, context.CancelFunc) {
+	ctx := metadata.NewOutgoingContext(context.Background(), c.headers.md())
+	if c.timeout > 0 {
+		return context.WithTimeout(ctx, c.timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// -H key=value を繰り返し指定できるフラグ
+type metadataFlag []string
+
+func (m *metadataFlag) String() string {
+	return strings.Join(*m, ",")
+}
+
+func (m *metadataFlag) Set(v string) error {
+	key, _, ok := strings.Cut(v, "=")
+	if !ok || strings.TrimSpace(key) == "" {
+		return fmt.Errorf("metadata must be key=value, got %q", v)
+	}
+	*m = append(*m, v)
+	return nil
+}
+
+func (m metadataFlag) md() metadata.MD {
+	md := metadata.MD{}
+	for _, kv := range m {
+		key, value, _ := strings.Cut(kv, "=")
+		md.Append(strings.TrimSpace(key), value)
+	}
+	return md
+}
+
+// -outputの値 outputFormatsのどれか
+type outputFlag string
+
+func (o *outputFlag) String() string { return string(*o) }
+
+func (o *outputFlag) Set(v string) error {
+	for _, f := range outputFormats {
+		if v == f {
+			*o = outputFlag(v)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown output format %q (%s)", v, strings.Join(outputFormats, ", "))
+}
+
+// "UNAVAILABLE,DEADLINE_EXCEEDED" のようなカンマ区切りのステータスコード
+func parseCodes(v string) ([]codes.Code, error) {
+	var list []codes.Code
+	for _, name := range splitNames(v) {
+		var code codes.Code
+		//codes.CodeはJSONの文字列として名前を解析できる
+		if err := code.UnmarshalJSON([]byte(strconv.Quote(strings.ToUpper(name)))); err != nil {
+			return nil, fmt.Errorf("unknown status code %q", name)
+		}
+		list = append(list, code)
+	}
+	return list, nil
+}
+
+// カンマ区切りの名前を分割する
+func splitNames(v string) []string {
+	names := make([]string, 0)
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			names = append(names, s)
+		}
+	}
+	return names
+}
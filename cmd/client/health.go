@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// healthの終了コード
+// 0はSERVING、1はRPCの失敗、2はフラグの誤りで、他のサブコマンドと同じ
+const exitNotServing = 3
+
+// 終了コードを指定するエラー
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string { return e.err.Error() }
+func (e *exitError) Unwrap() error { return e.err }
+
+// client health --service mygrpc
+// SERVINGなら0、それ以外なら3で終了するので、コンテナのプローブに使える
+func runHealth(args []string) error {
+	var common commonFlags
+	fs := newFlagSet("health", "Check the server with the standard health checking protocol.\nExits with 0 when SERVING, 3 when not serving or the service is unknown, and 1 when the check fails.\nWith -watch, prints every status change until interrupted.")
+	common.register(fs, "")
+	service := fs.String("service", "", "service to check (empty checks the whole server)")
+	watch := fs.Bool("watch", false, "stream status changes with the Watch API until interrupted")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	conn, closeConn, err := common.dial()
+	if err != nil {
+		return err
+	}
+	defer closeConn()
+	client := healthpb.NewHealthClient(conn)
+	req := &healthpb.HealthCheckRequest{Service: *service}
+	if *watch {
+		return watchHealth(client, req, &common)
+	}
+
+	out := newPrinter(&common, os.Stdout, os.Stderr)
+	ctx, cancel := common.context()
+	defer cancel()
+	res, err := client.Check(ctx, req)
+	if status.Code(err) == codes.NotFound {
+		//登録されていないサービスはSERVICE_UNKNOWNとして扱う
+		res, err = &healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVICE_UNKNOWN}, nil
+	}
+	if err != nil {
+		out.status(err)
+		return err
+	}
+	if common.output == "text" {
+		fmt.Println(res.GetStatus())
+	} else {
+		out.response(res)
+		out.status(nil)
+	}
+	if res.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		return &exitError{exitNotServing, fmt.Errorf("service %q is %s", *service, res.GetStatus())}
+	}
+	return nil
+}
+
+// Watchで受け取った状態を中断されるまで出力する
+// serverに接続できなくなった場合は再接続して監視を続ける
+func watchHealth(client healthpb.HealthClient, req *healthpb.HealthCheckRequest, common *commonFlags) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	out := newPrinter(common, os.Stdout, os.Stderr)
+	last := ""
+
+	//前回と異なる状態になった時だけ出力する
+	report := func(res *healthpb.HealthCheckResponse, state string) {
+		if state == last {
+			return
+		}
+		last = state
+		if common.output == "text" {
+			fmt.Printf("%s\t%s\n", time.Now().Format(time.RFC3339Nano), state)
+		} else if res != nil {
+			out.response(res)
+		}
+	}
+
+	for {
+		stream, err := client.Watch(metadata.NewOutgoingContext(ctx, common.headers.md()), req)
+		for err == nil {
+			var res *healthpb.HealthCheckResponse
+			if res, err = stream.Recv(); err == nil {
+				report(res, res.GetStatus().String())
+			}
+		}
+		if ctx.Err() != nil {
+			out.status(nil)
+			return nil
+		}
+		//Watchに対応していないserverなどは再接続しても変わらない
+		if status.Code(err) != codes.Unavailable {
+			out.status(err)
+			return err
+		}
+		report(nil, "UNAVAILABLE")
+		select {
+		case <-time.After(time.Second):
+		case <-ctx.Done():
+			out.status(nil)
+			return nil
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	hellopb "grpctutorial/pkg/grpc"
+	"grpctutorial/pkg/rpcerr"
+
+	//status.detailsに含まれるエラー詳細をJSONに変換できるように型を登録する
+	_ "google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+// 使える出力形式
+var outputFormats = []string{"text", "json", "ndjson"}
+
+// RPCの結果の出力先
+type printer interface {
+	//レスポンスヘッダー
+	header(md metadata.MD)
+	//レスポンス1つ分
+	response(res proto.Message)
+	//レスポンストレーラー
+	trailer(md metadata.MD)
+	//RPCの結果 最後に1回だけ呼ぶ
+	status(err error)
+}
+
+// 出力形式に応じたprinterを返す
+// 処理時間はprinterを作った時点から計る
+func newPrinter(c *commonFlags, stdout, stderr io.Writer) printer {
+	start := time.Now()
+	switch c.output {
+	case "json":
+		return &jsonPrinter{out: stdout, start: start}
+	case "ndjson":
+		return &ndjsonPrinter{enc: json.NewEncoder(stdout), start: start}
+	}
+	return &textPrinter{out: stdout, meta: stderr, verbose: c.verbose, start: start}
+}
+
+// レスポンスのメッセージを1行ずつ出力する
+// -vを指定するとヘッダー・トレーラー・ステータスを標準エラー出力に出力する
+type textPrinter struct {
+	out     io.Writer
+	meta    io.Writer
+	verbose bool
+	start   time.Time
+}
+
+func (p *textPrinter) header(md metadata.MD) {
+	if p.verbose {
+		fmt.Fprintf(p.meta, "header: %s\n", formatMD(md))
+	}
+}
+
+func (p *textPrinter) response(res proto.Message) {
+	if res, ok := res.(*hellopb.HelloResponse); ok {
+		fmt.Fprintln(p.out, res.GetMessage())
+		return
+	}
+	//protojsonの出力は空白が安定しないので整形し直す
+	var b bytes.Buffer
+	json.Indent(&b, messageJSON(res), "", "  ")
+	fmt.Fprintln(p.out, b.String())
+}
+
+func (p *textPrinter) trailer(md metadata.MD) {
+	if p.verbose {
+		fmt.Fprintf(p.meta, "trailer: %s\n", formatMD(md))
+	}
+}
+
+func (p *textPrinter) status(err error) {
+	if p.verbose {
+		fmt.Fprintf(p.meta, "status: %s (%v)\n", status.Code(err), time.Since(p.start).Round(time.Microsecond))
+	}
+}
+
+// RPCの結果をまとめて1つのJSONオブジェクトとして出力する
+type jsonPrinter struct {
+	out    io.Writer
+	start  time.Time
+	result struct {
+		Header    map[string][]string `json:"header,omitempty"`
+		Responses []json.RawMessage   `json:"responses"`
+		Trailer   map[string][]string `json:"trailer,omitempty"`
+		Status    statusJSON          `json:"status"`
+		Elapsed   string              `json:"elapsed"`
+	}
+}
+
+func (p *jsonPrinter) header(md metadata.MD) {
+	p.result.Header = mdJSON(md)
+}
+
+func (p *jsonPrinter) response(res proto.Message) {
+	p.result.Responses = append(p.result.Responses, messageJSON(res))
+}
+
+func (p *jsonPrinter) trailer(md metadata.MD) {
+	p.result.Trailer = mdJSON(md)
+}
+
+func (p *jsonPrinter) status(err error) {
+	if p.result.Responses == nil {
+		p.result.Responses = []json.RawMessage{}
+	}
+	p.result.Status = newStatusJSON(err)
+	p.result.Elapsed = elapsed(p.start)
+	b, _ := json.MarshalIndent(&p.result, "", "  ")
+	fmt.Fprintf(p.out, "%s\n", b)
+}
+
+// 出来事を1行1つのJSONオブジェクトとして出力する
+// ストリームのレスポンスは受け取る度に出力される
+type ndjsonPrinter struct {
+	enc   *json.Encoder
+	start time.Time
+}
+
+// ndjsonの1行
+type event struct {
+	Type     string              `json:"type"`
+	Metadata map[string][]string `json:"metadata,omitempty"`
+	Message  json.RawMessage     `json:"message,omitempty"`
+	Status   *statusJSON         `json:"status,omitempty"`
+	Elapsed  string              `json:"elapsed"`
+}
+
+func (p *ndjsonPrinter) header(md metadata.MD) {
+	p.enc.Encode(event{Type: "header", Metadata: mdJSON(md), Elapsed: elapsed(p.start)})
+}
+
+func (p *ndjsonPrinter) response(res proto.Message) {
+	p.enc.Encode(event{Type: "response", Message: messageJSON(res), Elapsed: elapsed(p.start)})
+}
+
+func (p *ndjsonPrinter) trailer(md metadata.MD) {
+	p.enc.Encode(event{Type: "trailer", Metadata: mdJSON(md), Elapsed: elapsed(p.start)})
+}
+
+func (p *ndjsonPrinter) status(err error) {
+	s := newStatusJSON(err)
+	p.enc.Encode(event{Type: "status", Status: &s, Elapsed: elapsed(p.start)})
+}
+
+// gRPCのステータスのJSON表現
+type statusJSON struct {
+	//"OK"や"InvalidArgument"などのコード名
+	Code    string            `json:"code"`
+	Number  int               `json:"number"`
+	Message string            `json:"message,omitempty"`
+	Details []json.RawMessage `json:"details,omitempty"`
+}
+
+func newStatusJSON(err error) statusJSON {
+	s := status.Convert(err)
+	sj := statusJSON{Code: s.Code().String(), Number: int(s.Code()), Message: s.Message()}
+	for _, d := range s.Proto().GetDetails() {
+		sj.Details = append(sj.Details, anyJSON(d))
+	}
+	return sj
+}
+
+// protojsonでメッセージをJSONにする
+func messageJSON(m proto.Message) json.RawMessage {
+	b, err := protojson.Marshal(m)
+	if err != nil {
+		b, _ = json.Marshal(map[string]string{"error": err.Error()})
+	}
+	return b
+}
+
+// 型が分からないエラー詳細は型名とbase64の値で表す
+func anyJSON(a *anypb.Any) json.RawMessage {
+	if b, err := protojson.Marshal(a); err == nil {
+		return b
+	}
+	b, _ := json.Marshal(map[string]string{"@type": a.GetTypeUrl(), "value": base64.StdEncoding.EncodeToString(a.GetValue())})
+	return b
+}
+
+// メタデータをJSONにする
+// -binで終わるキーの値はバイナリなのでbase64にする
+func mdJSON(md metadata.MD) map[string][]string {
+	if len(md) == 0 {
+		return nil
+	}
+	m := make(map[string][]string, len(md))
+	for k, vs := range md {
+		if strings.HasSuffix(k, "-bin") {
+			encoded := make([]string, len(vs))
+			for i, v := range vs {
+				encoded[i] = base64.StdEncoding.EncodeToString([]byte(v))
+			}
+			vs = encoded
+		}
+		m[k] = vs
+	}
+	return m
+}
+
+// printerを作ってからの経過時間 protojsonのDurationと同じ "1.5s" の形式
+func elapsed(start time.Time) string {
+	return fmt.Sprintf("%.6fs", time.Since(start).Seconds())
+}
+
+// エラーとステータスの詳細を出力する
+func printError(w io.Writer, prefix string, err error) {
+	fmt.Fprintf(w, "%s%v\n", prefix, err)
+	for _, line := range rpcerr.Describe(err) {
+		fmt.Fprintf(w, "  %s\n", line)
+	}
+}
+
+// メタデータをキーの順に key=value で並べる
+func formatMD(md metadata.MD) string {
+	keys := make([]string, 0, len(md))
+	for k := range md {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		for _, v := range md[k] {
+			pairs = append(pairs, k+"="+v)
+		}
+	}
+	return strings.Join(pairs, " ")
+}
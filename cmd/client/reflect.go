@@ -0,0 +1,223 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"grpctutorial/pkg/reflectclient"
+
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// client list [service]
+// サービスを指定しなければサービスの一覧、指定すればメソッドの一覧を出力する
+func runList(args []string) error {
+	var common commonFlags
+	fs := newFlagSet("list", "List the services exposed by server reflection, or the methods of one service.", "[service]")
+	common.register(fs, "")
+	service, err := parseWithArg(fs, args, false)
+	if err != nil {
+		return err
+	}
+
+	conn, closeConn, err := common.dial()
+	if err != nil {
+		return err
+	}
+	defer closeConn()
+	ctx, cancel := common.context()
+	defer cancel()
+	rc := reflectclient.New(conn)
+
+	if service == "" {
+		services, err := rc.ListServices(ctx)
+		if err != nil {
+			return err
+		}
+		for _, s := range services {
+			fmt.Println(s)
+		}
+		return nil
+	}
+	sd, err := rc.Service(ctx, service)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < sd.Methods().Len(); i++ {
+		fmt.Printf("%s/%s\n", sd.FullName(), sd.Methods().Get(i).Name())
+	}
+	return nil
+}
+
+// client describe myapp.GreetingService
+// サービス・メソッド・メッセージなどの定義を出力する
+func runDescribe(args []string) error {
+	var common commonFlags
+	fs := newFlagSet("describe", "Print the definition of a service, method, message or enum fetched with server reflection.", "<symbol>")
+	common.register(fs, "")
+	symbol, err := parseWithArg(fs, args, true)
+	if err != nil {
+		return err
+	}
+
+	conn, closeConn, err := common.dial()
+	if err != nil {
+		return err
+	}
+	defer closeConn()
+	ctx, cancel := common.context()
+	defer cancel()
+	rc := reflectclient.New(conn)
+
+	//"pkg.Service/Method" の形式も受け付ける
+	var d protoreflect.Descriptor
+	if strings.Contains(symbol, "/") {
+		d, err = rc.Method(ctx, symbol)
+	} else {
+		d, err = rc.FindSymbol(ctx, symbol)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Print(reflectclient.Describe(d))
+	return nil
+}
+
+// client call myapp.GreetingService/Hello -d '{"name":"bob"}'
+// リフレクションで取得した定義を使って、生成コードなしで任意のメソッドを呼び出す
+func runCall(args []string) error {
+	var common commonFlags
+	fs := newFlagSet("call", "Invoke any method with JSON request bodies, using the definitions fetched with server reflection.\nClient streaming methods accept several JSON objects, one after another.", "<service/method>")
+	common.register(fs, "")
+	data := fs.String("d", "{}", "request body as JSON; @ reads the bodies from stdin")
+	method, err := parseWithArg(fs, args, true)
+	if err != nil {
+		return err
+	}
+
+	conn, closeConn, err := common.dial()
+	if err != nil {
+		return err
+	}
+	defer closeConn()
+	ctx, cancel := common.context()
+	defer cancel()
+
+	md, err := reflectclient.New(conn).Method(ctx, method)
+	if err != nil {
+		return err
+	}
+	var body io.Reader = strings.NewReader(*data)
+	if *data == "@" {
+		body = os.Stdin
+	}
+
+	out := newPrinter(&common, os.Stdout, os.Stderr)
+	desc := &grpc.StreamDesc{
+		StreamName:    string(md.Name()),
+		ServerStreams: md.IsStreamingServer(),
+		ClientStreams: md.IsStreamingClient(),
+	}
+	stream, err := conn.NewStream(ctx, desc, reflectclient.FullMethod(md))
+	if err != nil {
+		out.status(err)
+		return err
+	}
+
+	//送信処理 双方向ストリーミングでは受信と並行して送る
+	sendErr := make(chan error, 1)
+	go func() {
+		err := sendJSON(stream, md, body)
+		if err == nil || errors.Is(err, io.EOF) {
+			//送信に失敗した理由はRecvMsgで受け取るステータスで分かる
+			if cerr := stream.CloseSend(); err == nil {
+				err = cerr
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			err = nil
+		}
+		//リクエストが不正な場合は受信を待たずにRPCを取り消す
+		if err != nil {
+			cancel()
+		}
+		sendErr <- err
+	}()
+
+	//受信処理
+	err = recvAll(stream, out, func() (proto.Message, error) {
+		res := dynamicpb.NewMessage(md.Output())
+		return res, stream.RecvMsg(res)
+	})
+	if serr := <-sendErr; serr != nil {
+		err = serr
+	}
+	out.status(err)
+	return err
+}
+
+// bodyから読んだJSONをリクエストに変換して送る
+// クライアントストリーミングでなければちょうど1つでなければならない
+func sendJSON(stream grpc.ClientStream, md protoreflect.MethodDescriptor, body io.Reader) error {
+	dec := json.NewDecoder(body)
+	for n := 0; ; n++ {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			if errors.Is(err, io.EOF) {
+				if n == 0 && !md.IsStreamingClient() {
+					return fmt.Errorf("%s needs a request body", md.FullName())
+				}
+				return nil
+			}
+			return fmt.Errorf("request %d: %w", n+1, err)
+		}
+		if n > 0 && !md.IsStreamingClient() {
+			return fmt.Errorf("%s takes exactly one request body", md.FullName())
+		}
+		req := dynamicpb.NewMessage(md.Input())
+		if err := protojson.Unmarshal(raw, req); err != nil {
+			return fmt.Errorf("request %d: %w", n+1, err)
+		}
+		if err := stream.SendMsg(req); err != nil {
+			return err
+		}
+	}
+}
+
+// フラグと1つの引数を解析する
+// 引数はフラグの前後どちらに書いてもよい
+func parseWithArg(fs *flag.FlagSet, args []string, required bool) (string, error) {
+	var arg string
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		arg, args = args[0], args[1:]
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return "", err
+		}
+		return "", errUsage
+	}
+	//引数の後ろに書かれたフラグを解析する
+	rest := fs.Args()
+	if arg == "" && len(rest) > 0 {
+		arg, rest = rest[0], rest[1:]
+	}
+	if err := parseFlags(fs, rest); err != nil {
+		return "", err
+	}
+	if required && arg == "" {
+		fmt.Fprintln(fs.Output(), "missing argument")
+		fs.Usage()
+		return "", errUsage
+	}
+	return arg, nil
+}
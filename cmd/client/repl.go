@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"grpctutorial/pkg/greeterclient"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// HelloClientStreamとHelloBiStreamsで送る名前の数
+const replSendCount = 5
+
+// 対話形式のメニュー
+// 入力と出力を差し替えられるので、標準入力がなくても動かせる
+type repl struct {
+	in     *bufio.Scanner
+	out    io.Writer
+	client *greeterclient.Client
+	common *commonFlags
+	//HelloServerStreamで指定する送信方法 0ならserverのデフォルト
+	stream greeterclient.StreamOptions
+}
+
+// client repl
+// 対話形式でRPCを選んで実行する
+func runRepl(args []string) error {
+	var common commonFlags
+	var streamCount uint
+	var streamInterval time.Duration
+	var streamMaxRate float64
+	fs := newFlagSet("repl", "Choose an RPC from a menu and type the names interactively.")
+	common.register(fs, "example")
+	fs.UintVar(&streamCount, "stream-count", 0, "number of messages requested from HelloServerStream (0 uses the server default)")
+	fs.DurationVar(&streamInterval, "stream-interval", 0, "interval between HelloServerStream messages (0 uses the server default)")
+	fs.Float64Var(&streamMaxRate, "stream-max-rate", 0, "maximum HelloServerStream messages per second (0 uses the server limit)")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	//スタート時間・処理時間表示
+	startTime := time.Now()
+	fmt.Printf("client start\ttime: %v \n", startTime)
+	defer func() {
+		fmt.Printf("\n processing time: %v", time.Since(startTime).Milliseconds())
+	}()
+
+	//gRPCserverとのコネクションを確立してクライアントを作成
+	client, closeConn, err := common.connect("")
+	if err != nil {
+		return err
+	}
+	defer closeConn()
+
+	r := &repl{
+		//標準入力から文字列を受け取るスキャナを用意
+		in:     bufio.NewScanner(os.Stdin),
+		out:    os.Stdout,
+		client: client,
+		common: &common,
+		stream: greeterclient.StreamOptions{Count: uint32(streamCount), Interval: streamInterval, MaxRate: streamMaxRate},
+	}
+	return r.run()
+}
+
+// 終了が選ばれるか入力が終わるまでメニューを繰り返す
+func (r *repl) run() error {
+	for {
+		fmt.Fprintln(r.out, "-1: exit")
+		fmt.Fprintln(r.out, "1: send Request")
+		fmt.Fprintln(r.out, "2: Server Stream")
+		fmt.Fprintln(r.out, "3: Client Stream")
+		fmt.Fprintln(r.out, "4: Bi Stream")
+		fmt.Fprintf(r.out, "please enter >>")
+
+		//入力が終わった場合も終了する
+		in, ok := r.readLine()
+		if !ok {
+			fmt.Fprintln(r.out, "bye.")
+			return r.in.Err()
+		}
+
+		switch in {
+		case "-1":
+			fmt.Fprintln(r.out, "bye.")
+			return nil
+
+		case "1":
+			r.hello()
+
+		case "2":
+			r.serverStream()
+
+		case "3":
+			r.clientStream()
+
+		case "4":
+			r.biStream()
+		}
+	}
+}
+
+// 1行読む 入力が終わっていればfalseを返す
+func (r *repl) readLine() (string, bool) {
+	if !r.in.Scan() {
+		return "", false
+	}
+	return r.in.Text(), true
+}
+
+// Unary RPCがリクエストを送るところ
+func (r *repl) hello() {
+	fmt.Fprintln(r.out, "Pleace enter your name")
+	name, _ := r.readLine()
+
+	//メタデータ
+	ctx, cancel := r.common.context()
+	defer cancel()
+	ctx = metadata.AppendToOutgoingContext(ctx, "type", "unary", "from", "client")
+
+	//Helloメソッドの実行
+	var header, trailer metadata.MD
+	greeting, err := r.client.Hello(ctx, name, grpc.Header(&header), grpc.Trailer(&trailer))
+	if err != nil {
+		printError(r.out, "", err)
+		return
+	}
+	fmt.Fprintln(r.out, header)
+	fmt.Fprintln(r.out, trailer)
+	fmt.Fprintln(r.out, greeting)
+}
+
+// serverストリームがレスポンスを複数送るところ
+func (r *repl) serverStream() {
+	fmt.Fprintln(r.out, "Plase enter your name.")
+	name, _ := r.readLine()
+
+	ctx, cancel := r.common.context()
+	defer cancel()
+	stream, err := r.client.HelloServerStream(ctx, name, r.stream)
+	if err != nil {
+		printError(r.out, "", err)
+		return
+	}
+	for stream.Next() {
+		fmt.Fprintln(r.out, stream.Response())
+	}
+	//キャンセルや期限切れもここで表示される
+	if err := stream.Err(); err != nil {
+		printError(r.out, "", err)
+		return
+	}
+	fmt.Fprintln(r.out, "all the responses have already received.")
+}
+
+// Client Stream RPCがリクエストを送るところ
+func (r *repl) clientStream() {
+	ctx, cancel := r.common.context()
+	defer cancel()
+
+	//全ての名前を1つのストリームで送る
+	batcher := r.client.NewBatcher(ctx, 0)
+	fmt.Fprintf(r.out, "Please enter %d names.\n", replSendCount)
+	for i := 0; i < replSendCount; i++ {
+		name, _ := r.readLine()
+		if err := batcher.Add(name); err != nil {
+			break
+		}
+	}
+
+	//受信
+	greetings, err := batcher.Close()
+	if err != nil {
+		printError(r.out, "", err)
+		return
+	}
+	for _, greeting := range greetings {
+		fmt.Fprintln(r.out, greeting)
+	}
+}
+
+// 双方向streaming
+func (r *repl) biStream() {
+	//メタデータ
+	ctx, cancel := r.common.context()
+	defer cancel()
+	ctx = metadata.AppendToOutgoingContext(ctx, "type", "stream", "from", "client")
+
+	//serverの双方向ストリーミングRPCメソッドと接続
+	session, err := r.client.HelloBiStreams(ctx)
+	if err != nil {
+		printError(r.out, "", err)
+		return
+	}
+
+	fmt.Fprintf(r.out, "Please enter %d names.\n", replSendCount)
+	//送信処理 入力を待つ間も受信した挨拶を表示する
+	sendDone := make(chan struct{})
+	go func() {
+		defer close(sendDone)
+		defer session.CloseSend()
+		for i := 0; i < replSendCount; i++ {
+			name, _ := r.readLine()
+			//送信に失敗した理由はErrで分かる
+			if err := session.Send(name); err != nil {
+				return
+			}
+		}
+	}()
+
+	//受信処理
+	if header, err := session.Header(); err == nil {
+		fmt.Fprintln(r.out, header)
+	}
+	for greeting := range session.Greetings() {
+		fmt.Fprintln(r.out, greeting)
+	}
+	if err := session.Err(); err != nil {
+		printError(r.out, "", err)
+	}
+	fmt.Fprintln(r.out, session.Trailer())
+
+	//次のメニューと入力を取り合わないように送信の終了を待つ
+	<-sendDone
+}
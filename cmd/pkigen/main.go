@@ -0,0 +1,25 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+
+	"grpctutorial/pkg/certs"
+)
+
+// テスト用の自己署名PKIを作成する
+func main() {
+	out := flag.String("out", "testdata/pki", "output directory")
+	hosts := flag.String("hosts", "localhost,127.0.0.1", "comma separated host names or IP addresses for the server certificate")
+	flag.Parse()
+
+	p, err := certs.GeneratePKI(*out, strings.Split(*hosts, ","))
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(p.CAFile)
+	fmt.Println(p.ServerCertFile, p.ServerKeyFile)
+	fmt.Println(p.ClientCertFile, p.ClientKeyFile)
+}
@@ -0,0 +1,665 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"grpctutorial/pkg/auth"
+	"grpctutorial/pkg/chain"
+	"grpctutorial/pkg/fault"
+	"grpctutorial/pkg/greeter"
+	"grpctutorial/pkg/logging"
+	"grpctutorial/pkg/ratelimit"
+	"grpctutorial/pkg/validate"
+
+	"golang.org/x/text/language"
+	"gopkg.in/yaml.v3"
+)
+
+// 環境変数の接頭辞
+const EnvPrefix = "GRPCTUTORIAL_"
+
+// サーバーの設定
+// 優先順位は フラグ > 環境変数 > 設定ファイル > デフォルト値
+type Config struct {
+	//待ち受けるアドレス
+	Address string `yaml:"address" json:"address"`
+
+	//有効にするインターセプター(並べた順に実行される)
+	Interceptors []string `yaml:"interceptors" json:"interceptors"`
+
+	//インターセプター毎のオプション
+	InterceptorOptions map[string]map[string]string `yaml:"interceptor_options" json:"interceptor_options"`
+
+	//SERVINGとして登録するヘルスチェックのサービス名
+	HealthServices []string `yaml:"health_services" json:"health_services"`
+
+	//serverリフレクションを有効にするか
+	Reflection bool `yaml:"reflection" json:"reflection"`
+
+	//挨拶するリクエストの設定
+	Greeting GreetingConfig `yaml:"greeting" json:"greeting"`
+
+	//HelloServerStreamの設定
+	Stream StreamConfig `yaml:"stream" json:"stream"`
+
+	//validationインターセプターの設定
+	Validation validate.Policy `yaml:"validation" json:"validation"`
+
+	//faultインターセプターの設定
+	Fault fault.Policy `yaml:"fault" json:"fault"`
+
+	//ratelimitインターセプターの設定 SIGHUPで読み込み直す
+	RateLimit ratelimit.Config `yaml:"rate_limit" json:"rate_limit"`
+
+	//TLSの設定
+	TLS TLSConfig `yaml:"tls" json:"tls"`
+
+	//authインターセプターの設定
+	Auth AuthConfig `yaml:"auth" json:"auth"`
+
+	//ログの設定
+	Log LogConfig `yaml:"log" json:"log"`
+
+	//メトリクスの設定
+	Metrics MetricsConfig `yaml:"metrics" json:"metrics"`
+
+	//トレーシングの設定
+	Tracing TracingConfig `yaml:"tracing" json:"tracing"`
+
+	//終了時の設定
+	Shutdown ShutdownConfig `yaml:"shutdown" json:"shutdown"`
+}
+
+// 終了時の設定
+// ヘルスチェックをNOT_SERVINGにしてからDrainPeriodだけ待ち、処理中のRPCの終了をTimeoutまで待つ
+type ShutdownConfig struct {
+	//ロードバランサーがNOT_SERVINGに気付いて振り分けをやめるまでの時間
+	DrainPeriod Duration `yaml:"drain_period" json:"drain_period"`
+	//処理中のRPCを待つ時間 過ぎたら強制的に切断する
+	Timeout Duration `yaml:"timeout" json:"timeout"`
+}
+
+// トレーシングの設定
+type TracingConfig struct {
+	//none, stdout, otlp-file のいずれか
+	Exporter string `yaml:"exporter" json:"exporter"`
+	//otlp-fileの出力先
+	File string `yaml:"file" json:"file"`
+	//スパンに付けるservice.name
+	ServiceName string `yaml:"service_name" json:"service_name"`
+}
+
+// メトリクスの設定
+type MetricsConfig struct {
+	///metricsを公開するHTTPのアドレス 空なら公開しない
+	Address string `yaml:"address" json:"address"`
+}
+
+// ログの設定
+type LogConfig struct {
+	//text か json
+	Format string `yaml:"format" json:"format"`
+	//debug, info, warn, error のいずれか
+	Level string `yaml:"level" json:"level"`
+}
+
+// 挨拶するリクエストの設定
+type GreetingConfig struct {
+	//リクエストとaccept-languageのどちらにも一致する言語がない場合に使う言語
+	DefaultLanguage string `yaml:"default_language" json:"default_language"`
+	//"ja.yaml" のように言語タグをファイル名にしたテンプレートを置くディレクトリ
+	//組み込みの挨拶(ja, en)を置き換えたり、言語を追加したりできる
+	TemplatesDir string `yaml:"templates_dir" json:"templates_dir"`
+	//名前の最大文字数
+	//validationインターセプターを外してもハンドラで確認する 細かいルールはvalidation.methodsに書く
+	MaxNameLength int `yaml:"max_name_length" json:"max_name_length"`
+	//HelloClientStreamで1つのストリームに送れる名前の数
+	MaxNamesPerStream int `yaml:"max_names_per_stream" json:"max_names_per_stream"`
+}
+
+// HelloServerStreamが返すストリームの設定
+// Count, Intervalはリクエストで指定されなかった場合に使う
+type StreamConfig struct {
+	//serverが送信する回数
+	Count int `yaml:"count" json:"count"`
+
+	//送信間隔
+	Interval Duration `yaml:"interval" json:"interval"`
+
+	//リクエストで指定できる送信回数の上限
+	MaxCount int `yaml:"max_count" json:"max_count"`
+
+	//リクエストで指定できる送信間隔の範囲
+	MinInterval Duration `yaml:"min_interval" json:"min_interval"`
+	MaxInterval Duration `yaml:"max_interval" json:"max_interval"`
+
+	//1秒あたりの最大送信数 0なら制限なし
+	MaxRate float64 `yaml:"max_rate" json:"max_rate"`
+
+	//HelloBiStreamsでリクエストを待つ時間 過ぎたらUnavailableでストリームを閉じる 0なら無制限
+	IdleTimeout Duration `yaml:"idle_timeout" json:"idle_timeout"`
+}
+
+// TLSの設定
+// CertFileとKeyFileを指定するとTLSが有効になる
+type TLSConfig struct {
+	CertFile string `yaml:"cert_file" json:"cert_file"`
+	KeyFile  string `yaml:"key_file" json:"key_file"`
+
+	//クライアント証明書を検証するCAバンドル
+	ClientCAFile string `yaml:"client_ca_file" json:"client_ca_file"`
+
+	//クライアント証明書の要求方法 none, request, require のいずれか
+	ClientAuth string `yaml:"client_auth" json:"client_auth"`
+
+	//証明書ファイルの変更を確認する間隔
+	ReloadInterval Duration `yaml:"reload_interval" json:"reload_interval"`
+}
+
+// TLSが有効か
+func (c TLSConfig) Enabled() bool {
+	return c.CertFile != ""
+}
+
+// authインターセプターの設定
+type AuthConfig struct {
+	//固定のAPIキー
+	APIKeys []APIKeyConfig `yaml:"api_keys" json:"api_keys"`
+
+	//HS256で署名されたJWTの検証設定
+	JWT JWTConfig `yaml:"jwt" json:"jwt"`
+
+	//FullMethod毎の認可ルール
+	Policy auth.Policy `yaml:"policy" json:"policy"`
+}
+
+type APIKeyConfig struct {
+	Key     string   `yaml:"key" json:"key"`
+	Subject string   `yaml:"subject" json:"subject"`
+	Roles   []string `yaml:"roles" json:"roles"`
+}
+
+type JWTConfig struct {
+	//空ならJWTは受け付けない
+	Secret   string   `yaml:"secret" json:"secret"`
+	Issuer   string   `yaml:"issuer" json:"issuer"`
+	Audience string   `yaml:"audience" json:"audience"`
+	Leeway   Duration `yaml:"leeway" json:"leeway"`
+}
+
+// デフォルトの設定を返す
+func Default() *Config {
+	return &Config{
+		Address:        ":8080",
+		Interceptors:   []string{"logging", "recovery", "validation", "example"},
+		HealthServices: []string{"mygrpc"},
+		Reflection:     true,
+		Greeting: GreetingConfig{
+			DefaultLanguage:   "en",
+			MaxNameLength:     64,
+			MaxNamesPerStream: 1000,
+		},
+		Stream: StreamConfig{
+			Count:       5,
+			Interval:    Duration(time.Second),
+			MaxCount:    10000,
+			MinInterval: Duration(10 * time.Millisecond),
+			MaxInterval: Duration(time.Minute),
+			MaxRate:     100,
+			IdleTimeout: Duration(5 * time.Minute),
+		},
+		Validation: greeter.DefaultValidation(),
+		RateLimit: ratelimit.Config{
+			//GreetingServiceは呼び出し元毎に1秒あたり50回(連続して100回)まで
+			Methods: map[string]ratelimit.Rule{
+				"/myapp.GreetingService/": {PerCallerRate: 50, PerCallerBurst: 100},
+			},
+			MaxStreamsPerCaller: 100,
+		},
+		TLS: TLSConfig{
+			ClientAuth:     "none",
+			ReloadInterval: Duration(10 * time.Second),
+		},
+		Auth: AuthConfig{
+			Policy: auth.Policy{
+				//ヘルスチェックとリフレクションは認証なしで呼び出せる
+				Methods: map[string]auth.Rule{
+					"/grpc.health.v1.Health/":                    {Public: true},
+					"/grpc.reflection.v1alpha.ServerReflection/": {Public: true},
+				},
+			},
+		},
+		Log: LogConfig{
+			Format: "text",
+			Level:  "info",
+		},
+		Tracing: TracingConfig{
+			Exporter:    "none",
+			ServiceName: "grpctutorial-server",
+		},
+		Shutdown: ShutdownConfig{
+			DrainPeriod: Duration(5 * time.Second),
+			Timeout:     Duration(10 * time.Second),
+		},
+	}
+}
+
+// 設定項目1つ分の定義
+// フラグと環境変数の両方から同じ関数で値を反映する
+type setting struct {
+	flag   string
+	env    string
+	usage  string
+	isBool bool
+	apply  func(c *Config, v string) error
+}
+
+var settings = []setting{
+	{
+		flag: "addr", env: "ADDR", usage: "listen address",
+		apply: func(c *Config, v string) error { c.Address = v; return nil },
+	},
+	{
+		flag: "interceptors", env: "INTERCEPTORS", usage: "comma separated list of enabled interceptors",
+		apply: func(c *Config, v string) error { c.Interceptors = splitList(v); return nil },
+	},
+	{
+		flag: "health-services", env: "HEALTH_SERVICES", usage: "comma separated list of health service names",
+		apply: func(c *Config, v string) error { c.HealthServices = splitList(v); return nil },
+	},
+	{
+		flag: "reflection", env: "REFLECTION", usage: "enable server reflection", isBool: true,
+		apply: func(c *Config, v string) (err error) { c.Reflection, err = parseBool(v); return err },
+	},
+	{
+		flag: "greeting-default-language", env: "GREETING_DEFAULT_LANGUAGE", usage: "language used when neither the request nor accept-language matches",
+		apply: func(c *Config, v string) error { c.Greeting.DefaultLanguage = v; return nil },
+	},
+	{
+		flag: "greeting-templates-dir", env: "GREETING_TEMPLATES_DIR", usage: "directory of greeting templates named by language tag (e.g. ja.yaml)",
+		apply: func(c *Config, v string) error { c.Greeting.TemplatesDir = v; return nil },
+	},
+	{
+		flag: "greeting-max-name-length", env: "GREETING_MAX_NAME_LENGTH", usage: "maximum number of characters in a name, checked even without the validation interceptor",
+		apply: func(c *Config, v string) (err error) { c.Greeting.MaxNameLength, err = parseInt(v); return err },
+	},
+	{
+		flag: "greeting-max-names-per-stream", env: "GREETING_MAX_NAMES_PER_STREAM", usage: "maximum number of names sent in one HelloClientStream",
+		apply: func(c *Config, v string) (err error) { c.Greeting.MaxNamesPerStream, err = parseInt(v); return err },
+	},
+	{
+		flag: "stream-count", env: "STREAM_COUNT", usage: "number of messages sent by HelloServerStream",
+		apply: func(c *Config, v string) (err error) { c.Stream.Count, err = parseInt(v); return err },
+	},
+	{
+		flag: "stream-interval", env: "STREAM_INTERVAL", usage: "interval between HelloServerStream messages",
+		apply: func(c *Config, v string) error { return c.Stream.Interval.UnmarshalText([]byte(v)) },
+	},
+	{
+		flag: "stream-max-count", env: "STREAM_MAX_COUNT", usage: "maximum message count a HelloServerStream request may ask for",
+		apply: func(c *Config, v string) (err error) { c.Stream.MaxCount, err = parseInt(v); return err },
+	},
+	{
+		flag: "stream-max-rate", env: "STREAM_MAX_RATE", usage: "maximum HelloServerStream messages per second (0 means unlimited)",
+		apply: func(c *Config, v string) (err error) { c.Stream.MaxRate, err = parseFloat(v); return err },
+	},
+	{
+		flag: "stream-idle-timeout", env: "STREAM_IDLE_TIMEOUT", usage: "close a HelloBiStreams stream after this long without a request (0 means never)",
+		apply: func(c *Config, v string) error { return c.Stream.IdleTimeout.UnmarshalText([]byte(v)) },
+	},
+	{
+		flag: "rate-limit-max-streams-per-caller", env: "RATE_LIMIT_MAX_STREAMS_PER_CALLER", usage: "maximum concurrent streams per caller (0 means unlimited)",
+		apply: func(c *Config, v string) (err error) { c.RateLimit.MaxStreamsPerCaller, err = parseInt(v); return err },
+	},
+	{
+		flag: "tls-cert", env: "TLS_CERT", usage: "server certificate file (enables TLS)",
+		apply: func(c *Config, v string) error { c.TLS.CertFile = v; return nil },
+	},
+	{
+		flag: "tls-key", env: "TLS_KEY", usage: "server private key file",
+		apply: func(c *Config, v string) error { c.TLS.KeyFile = v; return nil },
+	},
+	{
+		flag: "tls-client-ca", env: "TLS_CLIENT_CA", usage: "CA bundle used to verify client certificates",
+		apply: func(c *Config, v string) error { c.TLS.ClientCAFile = v; return nil },
+	},
+	{
+		flag: "tls-client-auth", env: "TLS_CLIENT_AUTH", usage: "client certificate policy: none, request or require",
+		apply: func(c *Config, v string) error { c.TLS.ClientAuth = v; return nil },
+	},
+	{
+		flag: "tls-reload-interval", env: "TLS_RELOAD_INTERVAL", usage: "interval for checking certificate file changes",
+		apply: func(c *Config, v string) error { return c.TLS.ReloadInterval.UnmarshalText([]byte(v)) },
+	},
+	{
+		flag: "auth-jwt-secret", env: "AUTH_JWT_SECRET", usage: "HMAC secret used to verify HS256 JWTs",
+		apply: func(c *Config, v string) error { c.Auth.JWT.Secret = v; return nil },
+	},
+	{
+		flag: "log-format", env: "LOG_FORMAT", usage: "log format: text or json",
+		apply: func(c *Config, v string) error { c.Log.Format = v; return nil },
+	},
+	{
+		flag: "log-level", env: "LOG_LEVEL", usage: "log level: debug, info, warn or error",
+		apply: func(c *Config, v string) error { c.Log.Level = v; return nil },
+	},
+	{
+		flag: "metrics-addr", env: "METRICS_ADDR", usage: "HTTP address serving /metrics (disabled if empty)",
+		apply: func(c *Config, v string) error { c.Metrics.Address = v; return nil },
+	},
+	{
+		flag: "tracing-exporter", env: "TRACING_EXPORTER", usage: "span exporter: none, stdout or otlp-file",
+		apply: func(c *Config, v string) error { c.Tracing.Exporter = v; return nil },
+	},
+	{
+		flag: "tracing-file", env: "TRACING_FILE", usage: "output file of the otlp-file exporter",
+		apply: func(c *Config, v string) error { c.Tracing.File = v; return nil },
+	},
+	{
+		flag: "shutdown-drain-period", env: "SHUTDOWN_DRAIN_PERIOD", usage: "how long to report NOT_SERVING before stopping on SIGINT/SIGTERM",
+		apply: func(c *Config, v string) error { return c.Shutdown.DrainPeriod.UnmarshalText([]byte(v)) },
+	},
+	{
+		flag: "shutdown-timeout", env: "SHUTDOWN_TIMEOUT", usage: "how long to wait for in-flight RPCs before closing them",
+		apply: func(c *Config, v string) error { return c.Shutdown.Timeout.UnmarshalText([]byte(v)) },
+	},
+}
+
+// フラグ・環境変数・設定ファイルから設定を読み込む
+// lookupEnvには通常os.LookupEnvを渡す
+func Load(name string, args []string, lookupEnv func(string) (string, bool)) (*Config, error) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	configPath := fs.String("config", "", "path to a YAML or JSON config file (env: "+EnvPrefix+"CONFIG)")
+
+	//コマンドラインで指定された値を指定順に記録する
+	type flagValue struct {
+		s *setting
+		v string
+	}
+	var flagValues []flagValue
+	for i := range settings {
+		s := &settings[i]
+		fs.Var(&funcValue{isBool: s.isBool, set: func(v string) error {
+			flagValues = append(flagValues, flagValue{s, v})
+			return nil
+		}}, s.flag, fmt.Sprintf("%s (env: %s%s)", s.usage, EnvPrefix, s.env))
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	cfg := Default()
+
+	//設定ファイル
+	path := *configPath
+	if path == "" {
+		path, _ = lookupEnv(EnvPrefix + "CONFIG")
+	}
+	if path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	//環境変数
+	for i := range settings {
+		s := &settings[i]
+		v, ok := lookupEnv(EnvPrefix + s.env)
+		if !ok {
+			continue
+		}
+		if err := s.apply(cfg, v); err != nil {
+			return nil, fmt.Errorf("env %s%s: %w", EnvPrefix, s.env, err)
+		}
+	}
+
+	//フラグ
+	for _, fv := range flagValues {
+		if err := fv.s.apply(cfg, fv.v); err != nil {
+			return nil, fmt.Errorf("flag -%s: %w", fv.s.flag, err)
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// 設定ファイルの内容をcfgに上書きする
+// 拡張子が.jsonならJSON、それ以外はYAMLとして読む
+// methodsなどのmapはデフォルトと混ぜずにファイルの内容で置き換え、ファイルに無ければデフォルトのままにする
+func (c *Config) loadFile(path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config file: %w", err)
+	}
+
+	//既存のmapに読み込むとキーが追加されるだけで、デフォルトのエントリを消せなくなる
+	defaults := *c
+	c.InterceptorOptions = nil
+	c.Validation.Methods = nil
+	c.Fault.Methods = nil
+	c.RateLimit.Methods = nil
+	c.Auth.Policy.Methods = nil
+	defer func() {
+		if c.InterceptorOptions == nil {
+			c.InterceptorOptions = defaults.InterceptorOptions
+		}
+		if c.Validation.Methods == nil {
+			c.Validation.Methods = defaults.Validation.Methods
+		}
+		if c.Fault.Methods == nil {
+			c.Fault.Methods = defaults.Fault.Methods
+		}
+		if c.RateLimit.Methods == nil {
+			c.RateLimit.Methods = defaults.RateLimit.Methods
+		}
+		if c.Auth.Policy.Methods == nil {
+			c.Auth.Policy.Methods = defaults.Auth.Policy.Methods
+		}
+	}()
+
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		dec := json.NewDecoder(bytes.NewReader(b))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(c)
+	} else {
+		dec := yaml.NewDecoder(bytes.NewReader(b))
+		dec.KnownFields(true)
+		err = dec.Decode(c)
+		//空のファイルはエラーにしない
+		if errors.Is(err, io.EOF) {
+			err = nil
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// 有効にするインターセプターを並べた順に返す
+func (c *Config) InterceptorSpecs() []chain.Spec {
+	specs := make([]chain.Spec, 0, len(c.Interceptors))
+	for _, name := range c.Interceptors {
+		specs = append(specs, chain.Spec{Name: name, Options: c.InterceptorOptions[name]})
+	}
+	return specs
+}
+
+// interceptorsにnameが含まれているか
+func (c *Config) hasInterceptor(name string) bool {
+	for _, n := range c.Interceptors {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// 設定値のエラー
+type ValidationError struct {
+	Field   string
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid config %s: %s", e.Field, e.Message)
+}
+
+// 設定値を検証する
+// エラーが複数ある場合はすべてまとめて返す
+func (c *Config) Validate() error {
+	var errs []error
+	invalid := func(field, format string, args ...interface{}) {
+		errs = append(errs, &ValidationError{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if _, _, err := net.SplitHostPort(c.Address); err != nil {
+		invalid("address", "%v", err)
+	}
+
+	seen := make(map[string]bool)
+	for _, name := range c.Interceptors {
+		if name == "" {
+			invalid("interceptors", "empty name")
+		} else if seen[name] {
+			invalid("interceptors", "%q is listed twice", name)
+		}
+		seen[name] = true
+	}
+
+	seen = make(map[string]bool)
+	for _, name := range c.HealthServices {
+		if name == "" {
+			//空白のサービス名はサーバー全体の状態として使うため指定できない
+			invalid("health_services", "empty name is reserved")
+		} else if seen[name] {
+			invalid("health_services", "%q is listed twice", name)
+		}
+		seen[name] = true
+	}
+
+	if _, err := language.Parse(c.Greeting.DefaultLanguage); err != nil {
+		invalid("greeting.default_language", "%v", err)
+	}
+	if c.Greeting.MaxNameLength <= 0 {
+		invalid("greeting.max_name_length", "must be positive, got %d", c.Greeting.MaxNameLength)
+	}
+	if c.Greeting.MaxNamesPerStream <= 0 {
+		invalid("greeting.max_names_per_stream", "must be positive, got %d", c.Greeting.MaxNamesPerStream)
+	}
+
+	if c.Stream.MaxCount <= 0 {
+		invalid("stream.max_count", "must be positive, got %d", c.Stream.MaxCount)
+	}
+	if c.Stream.Count <= 0 || c.Stream.Count > c.Stream.MaxCount {
+		invalid("stream.count", "must be between 1 and max_count %d, got %d", c.Stream.MaxCount, c.Stream.Count)
+	}
+	if c.Stream.MinInterval < 0 || c.Stream.MinInterval > c.Stream.MaxInterval {
+		invalid("stream.min_interval", "must be between 0 and max_interval %v, got %v", c.Stream.MaxInterval, c.Stream.MinInterval)
+	}
+	if c.Stream.Interval < c.Stream.MinInterval || c.Stream.Interval > c.Stream.MaxInterval {
+		invalid("stream.interval", "must be between min_interval %v and max_interval %v, got %v",
+			c.Stream.MinInterval, c.Stream.MaxInterval, c.Stream.Interval)
+	}
+	if !(c.Stream.MaxRate >= 0) || math.IsInf(c.Stream.MaxRate, 0) {
+		invalid("stream.max_rate", "must be a finite non-negative number, got %v", c.Stream.MaxRate)
+	}
+	if c.Stream.IdleTimeout < 0 {
+		invalid("stream.idle_timeout", "must not be negative, got %v", c.Stream.IdleTimeout)
+	}
+
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		invalid("tls", "cert_file and key_file must be specified together")
+	}
+	switch c.TLS.ClientAuth {
+	case "", "none":
+	case "request", "require":
+		if !c.TLS.Enabled() {
+			invalid("tls.client_auth", "%q requires cert_file and key_file", c.TLS.ClientAuth)
+		}
+		if c.TLS.ClientCAFile == "" {
+			invalid("tls.client_auth", "%q requires client_ca_file", c.TLS.ClientAuth)
+		}
+	default:
+		invalid("tls.client_auth", "unknown value %q (none, request or require)", c.TLS.ClientAuth)
+	}
+	if c.TLS.ClientCAFile != "" && !c.TLS.Enabled() {
+		invalid("tls.client_ca_file", "requires cert_file and key_file")
+	}
+	if c.TLS.ReloadInterval <= 0 {
+		invalid("tls.reload_interval", "must be positive, got %v", c.TLS.ReloadInterval)
+	}
+
+	if c.Metrics.Address != "" {
+		if _, _, err := net.SplitHostPort(c.Metrics.Address); err != nil {
+			invalid("metrics.address", "%v", err)
+		}
+		//metricsインターセプターが無いとRPCのメトリクスが記録されず、/metricsが空のままになる
+		if !c.hasInterceptor("metrics") {
+			invalid("metrics.address", "requires the metrics interceptor in interceptors")
+		}
+	}
+
+	switch c.Tracing.Exporter {
+	case "none", "stdout":
+	case "otlp-file":
+		if c.Tracing.File == "" {
+			invalid("tracing.file", "is required for the otlp-file exporter")
+		}
+	default:
+		invalid("tracing.exporter", "unknown value %q (none, stdout or otlp-file)", c.Tracing.Exporter)
+	}
+
+	if c.Shutdown.DrainPeriod < 0 {
+		invalid("shutdown.drain_period", "must not be negative, got %v", c.Shutdown.DrainPeriod)
+	}
+	if c.Shutdown.Timeout <= 0 {
+		invalid("shutdown.timeout", "must be positive, got %v", c.Shutdown.Timeout)
+	}
+
+	if err := c.Validation.Compile(); err != nil {
+		invalid("validation.methods", "%v", err)
+	}
+	if err := c.Fault.Compile(); err != nil {
+		invalid("fault.methods", "%v", err)
+	}
+	if err := c.RateLimit.Compile(); err != nil {
+		invalid("rate_limit", "%v", err)
+	}
+	if c.Log.Format != "text" && c.Log.Format != "json" {
+		invalid("log.format", "unknown value %q (text or json)", c.Log.Format)
+	}
+	if _, err := logging.ParseLevel(c.Log.Level); err != nil {
+		invalid("log.level", "%v", err)
+	}
+
+	if c.hasInterceptor("auth") && len(c.Auth.APIKeys) == 0 && c.Auth.JWT.Secret == "" {
+		invalid("auth", "api_keys or jwt.secret is required when the auth interceptor is enabled")
+	}
+	for i, k := range c.Auth.APIKeys {
+		if k.Key == "" || k.Subject == "" {
+			invalid(fmt.Sprintf("auth.api_keys[%d]", i), "key and subject are required")
+		}
+	}
+	for method := range c.Auth.Policy.Methods {
+		if !strings.HasPrefix(method, "/") {
+			invalid("auth.policy.methods", "%q must start with /", method)
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,345 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// envの値を返すlookupEnv
+func lookup(env map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		v, ok := env[key]
+		return v, ok
+	}
+}
+
+// 一時ディレクトリにnameの設定ファイルを書いてパスを返す
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// フラグ > 環境変数 > 設定ファイル > デフォルト値 の順に優先される
+func TestLoadPrecedence(t *testing.T) {
+	file := writeFile(t, "config.yaml", "address: \":9000\"\nstream:\n  count: 7\nlog:\n  level: debug\n")
+	tests := []struct {
+		name string
+		args []string
+		env  map[string]string
+
+		wantAddress string
+		wantCount   int
+		wantLevel   string
+	}{
+		{
+			name:        "defaults",
+			wantAddress: ":8080",
+			wantCount:   5,
+			wantLevel:   "info",
+		},
+		{
+			name:        "file overrides defaults",
+			args:        []string{"-config", file},
+			wantAddress: ":9000",
+			wantCount:   7,
+			wantLevel:   "debug",
+		},
+		{
+			name:        "config path from env",
+			env:         map[string]string{EnvPrefix + "CONFIG": file},
+			wantAddress: ":9000",
+			wantCount:   7,
+			wantLevel:   "debug",
+		},
+		{
+			name:        "env overrides file",
+			args:        []string{"-config", file},
+			env:         map[string]string{EnvPrefix + "ADDR": ":9001", EnvPrefix + "STREAM_COUNT": "8"},
+			wantAddress: ":9001",
+			wantCount:   8,
+			wantLevel:   "debug",
+		},
+		{
+			name:        "flags override env",
+			args:        []string{"-config", file, "-addr", ":9002"},
+			env:         map[string]string{EnvPrefix + "ADDR": ":9001", EnvPrefix + "STREAM_COUNT": "8"},
+			wantAddress: ":9002",
+			wantCount:   8,
+			wantLevel:   "debug",
+		},
+		{
+			//同じフラグは後に指定した方が使われる
+			name:        "last flag wins",
+			args:        []string{"-addr", ":9002", "-addr", ":9003", "-log-level", "warn"},
+			wantAddress: ":9003",
+			wantCount:   5,
+			wantLevel:   "warn",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := Load("server", tt.args, lookup(tt.env))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.Address != tt.wantAddress {
+				t.Errorf("address = %q, want %q", cfg.Address, tt.wantAddress)
+			}
+			if cfg.Stream.Count != tt.wantCount {
+				t.Errorf("stream.count = %d, want %d", cfg.Stream.Count, tt.wantCount)
+			}
+			if cfg.Log.Level != tt.wantLevel {
+				t.Errorf("log.level = %q, want %q", cfg.Log.Level, tt.wantLevel)
+			}
+		})
+	}
+}
+
+// 設定ファイルのmapはデフォルトに追加されず、置き換わる
+func TestLoadFileReplacesMaps(t *testing.T) {
+	const service = "/myapp.GreetingService/"
+	tests := []struct {
+		name    string
+		file    string
+		content string
+
+		//validation.methods、rate_limit.methods、auth.policy.methodsのキー
+		wantValidation []string
+		wantRateLimit  []string
+		wantAuth       []string
+	}{
+		{
+			name:           "keeps defaults when the file has no maps",
+			file:           "config.yaml",
+			content:        "address: \":9000\"\n",
+			wantValidation: []string{service},
+			wantRateLimit:  []string{service},
+			wantAuth:       []string{"/grpc.health.v1.Health/", "/grpc.reflection.v1alpha.ServerReflection/"},
+		},
+		{
+			name: "replaces default entries",
+			file: "config.yaml",
+			content: "validation:\n  methods:\n    /myapp.GreetingService/Hello:\n      name:\n        required: true\n" +
+				"rate_limit:\n  methods:\n    /myapp.GreetingService/Hello:\n      rate: 10\n      burst: 10\n" +
+				"auth:\n  policy:\n    methods:\n      /grpc.health.v1.Health/:\n        public: true\n",
+			wantValidation: []string{"/myapp.GreetingService/Hello"},
+			wantRateLimit:  []string{"/myapp.GreetingService/Hello"},
+			wantAuth:       []string{"/grpc.health.v1.Health/"},
+		},
+		{
+			name:    "removes all default entries with an empty map",
+			file:    "config.yaml",
+			content: "validation:\n  methods: {}\nrate_limit:\n  methods: {}\nauth:\n  policy:\n    methods: {}\n",
+		},
+		{
+			name:           "replaces default entries from JSON",
+			file:           "config.json",
+			content:        `{"validation": {"methods": {"/myapp.GreetingService/Hello": {"name": {"required": true}}}}}`,
+			wantValidation: []string{"/myapp.GreetingService/Hello"},
+			wantRateLimit:  []string{service},
+			wantAuth:       []string{"/grpc.health.v1.Health/", "/grpc.reflection.v1alpha.ServerReflection/"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := Load("server", []string{"-config", writeFile(t, tt.file, tt.content)}, lookup(nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkKeys(t, "validation.methods", keys(cfg.Validation.Methods), tt.wantValidation)
+			checkKeys(t, "rate_limit.methods", keys(cfg.RateLimit.Methods), tt.wantRateLimit)
+			checkKeys(t, "auth.policy.methods", keys(cfg.Auth.Policy.Methods), tt.wantAuth)
+		})
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		env  map[string]string
+		//エラーに含まれるはずの文字列
+		want string
+	}{
+		{
+			name: "unknown field in the file",
+			args: []string{"-config", writeFile(t, "config.yaml", "adress: \":9000\"\n")},
+			want: "field adress not found",
+		},
+		{
+			name: "unknown field in a JSON file",
+			args: []string{"-config", writeFile(t, "config.json", `{"adress": ":9000"}`)},
+			want: `unknown field "adress"`,
+		},
+		{
+			name: "missing file",
+			args: []string{"-config", filepath.Join(t.TempDir(), "missing.yaml")},
+			want: "config file",
+		},
+		{
+			name: "bad env value",
+			env:  map[string]string{EnvPrefix + "STREAM_COUNT": "many"},
+			want: "env " + EnvPrefix + "STREAM_COUNT",
+		},
+		{
+			name: "bad flag value",
+			args: []string{"-stream-count", "many"},
+			want: "flag -stream-count",
+		},
+		{
+			name: "invalid value after merging",
+			args: []string{"-log-format", "xml"},
+			want: "log.format",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Load("server", tt.args, lookup(tt.env))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("Load() error = %v, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(c *Config)
+		//ValidationErrorのField 空なら成功する
+		want []string
+	}{
+		{
+			name:   "defaults are valid",
+			modify: func(c *Config) {},
+		},
+		{
+			name:   "bad address",
+			modify: func(c *Config) { c.Address = "8080" },
+			want:   []string{"address"},
+		},
+		{
+			name:   "duplicate interceptor",
+			modify: func(c *Config) { c.Interceptors = []string{"logging", "logging"} },
+			want:   []string{"interceptors"},
+		},
+		{
+			name:   "reserved health service",
+			modify: func(c *Config) { c.HealthServices = []string{""} },
+			want:   []string{"health_services"},
+		},
+		{
+			name:   "stream count above max_count",
+			modify: func(c *Config) { c.Stream.Count = c.Stream.MaxCount + 1 },
+			want:   []string{"stream.count"},
+		},
+		{
+			name:   "interval outside the limits",
+			modify: func(c *Config) { c.Stream.Interval = Duration(time.Hour) },
+			want:   []string{"stream.interval"},
+		},
+		{
+			name: "cert without key",
+			modify: func(c *Config) {
+				c.TLS.CertFile = "server.crt"
+			},
+			want: []string{"tls"},
+		},
+		{
+			name:   "mTLS without TLS",
+			modify: func(c *Config) { c.TLS.ClientAuth = "require" },
+			want:   []string{"tls.client_auth", "tls.client_auth"},
+		},
+		{
+			name:   "metrics address without the metrics interceptor",
+			modify: func(c *Config) { c.Metrics.Address = ":9090" },
+			want:   []string{"metrics.address"},
+		},
+		{
+			name:   "auth without credentials",
+			modify: func(c *Config) { c.Interceptors = append(c.Interceptors, "auth") },
+			want:   []string{"auth"},
+		},
+		{
+			name: "bad validation rule",
+			modify: func(c *Config) {
+				r := c.Validation.Methods["/myapp.GreetingService/"]["name"]
+				r.Pattern = "("
+				c.Validation.Methods["/myapp.GreetingService/"]["name"] = r
+			},
+			want: []string{"validation.methods"},
+		},
+		{
+			name: "reports every error",
+			modify: func(c *Config) {
+				c.Log.Format = "xml"
+				c.Log.Level = "loud"
+				c.Shutdown.Timeout = 0
+			},
+			want: []string{"shutdown.timeout", "log.format", "log.level"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := Default()
+			tt.modify(c)
+			got := fields(c.Validate())
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("invalid fields = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// Validateのエラーに含まれるValidationErrorのFieldを順に返す
+func fields(err error) []string {
+	if err == nil {
+		return nil
+	}
+	var errs []error
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		errs = joined.Unwrap()
+	} else {
+		errs = []error{err}
+	}
+	var fields []string
+	for _, err := range errs {
+		var v *ValidationError
+		if errors.As(err, &v) {
+			fields = append(fields, v.Field)
+		}
+	}
+	return fields
+}
+
+func keys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// gotとwantが順序を問わず同じキーか確認する
+func checkKeys(t *testing.T, name string, got, want []string) {
+	t.Helper()
+	seen := make(map[string]bool)
+	for _, k := range got {
+		seen[k] = true
+	}
+	ok := len(got) == len(want)
+	for _, k := range want {
+		ok = ok && seen[k]
+	}
+	if !ok {
+		t.Errorf("%s = %q, want %q", name, got, want)
+	}
+}
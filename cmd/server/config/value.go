@@ -0,0 +1,60 @@
+package config
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 設定ファイルで"1s"や"500ms"のように書ける時間
+type Duration time.Duration
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+func (d *Duration) UnmarshalText(b []byte) error {
+	v, err := time.ParseDuration(string(b))
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+// flag.Valueを関数で実装する
+type funcValue struct {
+	isBool bool
+	set    func(string) error
+}
+
+func (f *funcValue) String() string     { return "" }
+func (f *funcValue) Set(v string) error { return f.set(v) }
+func (f *funcValue) IsBoolFlag() bool   { return f.isBool }
+
+// カンマ区切りの文字列を分割する
+func splitList(v string) []string {
+	list := make([]string, 0)
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			list = append(list, s)
+		}
+	}
+	return list
+}
+
+func parseBool(v string) (bool, error) {
+	return strconv.ParseBool(v)
+}
+
+func parseInt(v string) (int, error) {
+	return strconv.Atoi(v)
+}
+
+func parseFloat(v string) (float64, error) {
+	return strconv.ParseFloat(v, 64)
+}
@@ -3,180 +3,243 @@ package main
 import (
 	"context"
 	"errors"
-	"fmt"
-	"io"
+	"flag"
 	"log"
-	"net"
+	"log/slog"
+	"net/http"
 	"os"
 	"os/signal"
+	"syscall"
 	"time"
 
-	Interceptors "grpctutorial/cmd/server/Interceptor"
-	hellopb "grpctutorial/pkg/grpc"
-
-	"google.golang.org/grpc/metadata"
-	"google.golang.org/grpc/reflection"
+	"grpctutorial/cmd/server/config"
+	"grpctutorial/pkg/auth"
+	"grpctutorial/pkg/certs"
+	"grpctutorial/pkg/chain"
+	"grpctutorial/pkg/greeter"
+	"grpctutorial/pkg/logging"
+	"grpctutorial/pkg/metrics"
+	"grpctutorial/pkg/ratelimit"
+	Interceptors "grpctutorial/pkg/server/Interceptor"
+	"grpctutorial/pkg/tracing"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 
 	"google.golang.org/grpc/health"
 	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 )
 
-type myServer struct {
-	hellopb.UnimplementedGreetingServiceServer
-}
-
-// Unary RPCがレスポンスを返すところ
-func (m *myServer) Hello(ctx context.Context, req *hellopb.HelloRequest) (*hellopb.HelloResponse, error) {
-	//ctxからメタデータを取得
-	if md, ok := metadata.FromIncomingContext(ctx); ok {
-		log.Println(md)
-	}
-
-	//ヘッダーを作成
-	headerMD := metadata.New(map[string]string{"type": "unary", "from": "server", "in": "header"})
-	if err := grpc.SetHeader(ctx, headerMD); err != nil {
-		return nil, err
-	}
-
-	//トレイラーを作成
-	trailerMD := metadata.New(map[string]string{"type": "unary", "from": "server", "in": "trailer"})
-	if err := grpc.SetTrailer(ctx, trailerMD); err != nil {
-		return nil, err
-	}
-
-	// HelloResponse型を1つreturnする
-	// (Unaryなので、レスポンスを一つ返せば終わり)
-	return &hellopb.HelloResponse{
-		Message: fmt.Sprintf("hello %s", req.GetName()),
-	}, nil
-}
-
-// Server Stream RPCがレスポンスを返すところ
-func (s *myServer) HelloServerStream(req *hellopb.HelloRequest, stream hellopb.GreetingService_HelloServerStreamServer) error {
-	//serverが送信する回数
-	resCound := 5
-	for i := 0; i < resCound; i++ {
-		// streamのSendメソッドを使っている
-		if err := stream.Send(&hellopb.HelloResponse{
-			//reqに送信されたデータが入っている
-			Message: fmt.Sprintf("[%d] Hello, %s!", i, req.GetName()),
-		}); err != nil {
-			return err
-		}
-		//1秒 待機
-		time.Sleep(time.Second * 1)
-	}
-	return nil
+// 設定で指定された順にインターセプターを並べたChainを返す
+func interceptorChain(cfg *config.Config, logger *slog.Logger, m *Interceptors.ServerMetrics, tracer *tracing.Tracer, limiter *ratelimit.Limiter) (Interceptors.Chain, error) {
+	registry := Interceptors.NewRegistry()
+	registry.Register("logging", Interceptors.LoggingFactory(logger))
+	registry.Register("metrics", Interceptors.MetricsFactory(m))
+	registry.Register("tracing", Interceptors.TracingFactory(tracer))
+	policy := cfg.Auth.Policy
+	registry.Register("auth", Interceptors.AuthFactory(authenticator(cfg.Auth), &policy))
+	registry.Register("validation", Interceptors.ValidationFactory(&cfg.Validation))
+	registry.Register("fault", Interceptors.FaultFactory(&cfg.Fault))
+	registry.Register("ratelimit", Interceptors.RateLimitFactory(limiter))
+
+	return chain.Build(registry, cfg.InterceptorSpecs())
 }
 
-// Client Stream RPCがリクエストを受け取るところ
-func (s *myServer) HelloClientStream(stream hellopb.GreetingService_HelloClientStreamServer) error {
-	//受信した名前追加
-	nameList := make([]string, 0)
-	for {
-		//streamのRecvメソッドを呼び出してリクエスト内容を取得する
-		req, err := stream.Recv()
-		if errors.Is(err, io.EOF) {
-			//リクエストを全て受け取ったので纏めて返す!
-			message := fmt.Sprintf("Hello ,%v!", nameList)
-			//送信して閉じる
-			return stream.SendAndClose(&hellopb.HelloResponse{
-				Message: message,
-			})
+// SIGHUPを受け取る度に起動時と同じフラグ・環境変数・設定ファイルから設定を読み込み、レート制限を入れ替える
+// 読み込みに失敗した場合は今の制限を使い続ける
+func reloadOnHangup(hup <-chan os.Signal, limiter *ratelimit.Limiter, logger *slog.Logger) {
+	for range hup {
+		cfg, err := config.Load(os.Args[0], os.Args[1:], os.LookupEnv)
+		if err == nil {
+			err = limiter.Update(cfg.RateLimit)
 		}
 		if err != nil {
-			return err
+			logger.Error("failed to reload rate limits, keeping the current ones", "error", err)
+			continue
 		}
-		//名前のリストに新しい名前追加
-		nameList = append(nameList, req.GetName())
+		logger.Info("reloaded rate limits", "methods", len(cfg.RateLimit.Methods), "max_streams_per_caller", cfg.RateLimit.MaxStreamsPerCaller)
 	}
 }
 
-func (s *myServer) HelloBiStreams(stream hellopb.GreetingService_HelloBiStreamsServer) error {
-	//ストリームのコンテキストからメタデータを取得
-	if md, ok := metadata.FromIncomingContext(stream.Context()); ok {
-		log.Println(md)
+// 設定ファイルの内容に対応するgreeter.ServerのOption
+// インターセプターとTLSはロガーや証明書の監視が必要なので含まない
+func greeterOptions(cfg *config.Config) []greeter.Option {
+	return []greeter.Option{
+		greeter.WithAddress(cfg.Address),
+		greeter.WithHealth(cfg.HealthServices...),
+		greeter.WithReflection(cfg.Reflection),
+		greeter.WithGreeting(greeter.GreetingOptions{
+			DefaultLanguage:   cfg.Greeting.DefaultLanguage,
+			TemplatesDir:      cfg.Greeting.TemplatesDir,
+			MaxNameLength:     cfg.Greeting.MaxNameLength,
+			MaxNamesPerStream: cfg.Greeting.MaxNamesPerStream,
+		}),
+		greeter.WithStream(greeter.StreamOptions{
+			Count:       cfg.Stream.Count,
+			Interval:    time.Duration(cfg.Stream.Interval),
+			MaxCount:    cfg.Stream.MaxCount,
+			MinInterval: time.Duration(cfg.Stream.MinInterval),
+			MaxInterval: time.Duration(cfg.Stream.MaxInterval),
+			MaxRate:     cfg.Stream.MaxRate,
+			IdleTimeout: time.Duration(cfg.Stream.IdleTimeout),
+		}),
+		greeter.WithDrainPeriod(time.Duration(cfg.Shutdown.DrainPeriod)),
 	}
+}
 
-	//すぐにヘッダーを送信
-	headerMD := metadata.New(map[string]string{"type": "stream", "from": "server", "in": "header"})
-	if err := stream.SendHeader(headerMD); err != nil {
-		return err
+// 認証の設定からAPIキーとJWTの検証器を作る
+func authenticator(cfg config.AuthConfig) auth.Authenticator {
+	var authn auth.Authenticators
+	if len(cfg.APIKeys) > 0 {
+		keys := make(auth.StaticKeys, len(cfg.APIKeys))
+		for _, k := range cfg.APIKeys {
+			keys[k.Key] = auth.Identity{Subject: k.Subject, Roles: k.Roles}
+		}
+		authn = append(authn, keys)
 	}
+	if cfg.JWT.Secret != "" {
+		authn = append(authn, &auth.JWTVerifier{
+			Secret:   []byte(cfg.JWT.Secret),
+			Issuer:   cfg.JWT.Issuer,
+			Audience: cfg.JWT.Audience,
+			Leeway:   time.Duration(cfg.JWT.Leeway),
+		})
+	}
+	return authn
+}
 
-	//トレイラー作成
-	trailerMD := metadata.New(map[string]string{"type": "stream", "from": "server", "in": "trailer"})
-	stream.SetTrailer(trailerMD)
+// /metricsを公開するHTTPserverを作る
+func newMetricsServer(addr string, reg *metrics.Registry) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", reg.Handler())
+	return &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+}
 
-	errChan := make(chan error, 1)
-	go func() {
-		for {
-			req, err := stream.Recv()
-			if errors.Is(err, io.EOF) {
-				errChan <- nil
-				return
-			}
-			if err != nil {
-				errChan <- err
-				return
+// ヘルスチェックの現在の状態をメトリクスとして公開する
+func registerHealthMetrics(reg *metrics.Registry, healthSrv *health.Server, services []string) {
+	services = append([]string{""}, services...)
+	reg.NewGaugeFunc("grpc_health_status",
+		"Current health status per service (1 for the reported status).", []string{"service", "status"},
+		func() []metrics.Sample {
+			samples := make([]metrics.Sample, 0, len(services))
+			for _, name := range services {
+				res, err := healthSrv.Check(context.Background(), &healthpb.HealthCheckRequest{Service: name})
+				st := healthpb.HealthCheckResponse_SERVICE_UNKNOWN
+				if err == nil {
+					st = res.GetStatus()
+				}
+				samples = append(samples, metrics.Sample{LabelValues: []string{name, st.String()}, Value: 1})
 			}
-			message := fmt.Sprintf("Hello, %v!", req.GetName())
-			if err := stream.Send(&hellopb.HelloResponse{
-				Message: message,
-			}); err != nil {
-				errChan <- nil
-				return
-			}
-		}
-	}()
-	return <-errChan
+			return samples
+		})
 }
 
-// 自作サービス構造体のコンストラクタを定義
-func NewMyServer() *myServer {
-	return &myServer{}
+// TLSの設定からserverのクレデンシャルを作る
+// 返り値の関数を呼ぶと証明書の監視を終了する
+func tlsCredentials(cfg config.TLSConfig) (credentials.TransportCredentials, func(), error) {
+	clientAuth, err := certs.ParseClientAuth(cfg.ClientAuth)
+	if err != nil {
+		return nil, nil, err
+	}
+	reloader, err := certs.NewReloader(cfg.CertFile, cfg.KeyFile, cfg.ClientCAFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	go reloader.Watch(ctx, time.Duration(cfg.ReloadInterval))
+	return credentials.NewTLS(reloader.ServerConfig(clientAuth)), cancel, nil
 }
 
 func main() {
-	//ポート番号8080のLisnterを作成
-	port := 8080
-	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	//フラグ・環境変数・設定ファイルから設定を読み込む
+	cfg, err := config.Load(os.Args[0], os.Args[1:], os.LookupEnv)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
 	if err != nil {
-		panic(err)
+		log.Fatal(err)
 	}
 
+	//ロガーを作成
+	//log.Printfなどもこのロガーに出力される
+	logger, err := logging.New(os.Stderr, cfg.Log.Format, cfg.Log.Level)
+	if err != nil {
+		log.Fatal(err)
+	}
+	slog.SetDefault(logger)
+
 	//gRPCserverを作成
-	s := grpc.NewServer(
-		grpc.UnaryInterceptor(Interceptors.MyUnaryServerInterceptor1),
-		grpc.StreamInterceptor(Interceptors.MyStreamServerInterceptor1),
-	)
+	metricsRegistry := metrics.NewRegistry()
+	exporter, err := tracing.NewExporter(cfg.Tracing.Exporter, cfg.Tracing.File)
+	if err != nil {
+		log.Fatal(err)
+	}
+	tracer := tracing.NewTracer(cfg.Tracing.ServiceName, exporter)
+	defer tracer.Close()
+	limiter, err := ratelimit.New(cfg.RateLimit)
+	if err != nil {
+		log.Fatal(err)
+	}
+	chain, err := interceptorChain(cfg, logger, Interceptors.NewServerMetrics(metricsRegistry), tracer, limiter)
+	if err != nil {
+		log.Fatal(err)
+	}
+	opts := append(greeterOptions(cfg), greeter.WithInterceptors(chain), greeter.WithLogger(logger))
+	//TLSが設定されていれば証明書を読み込み、変更を監視する
+	if cfg.TLS.Enabled() {
+		creds, stopWatch, err := tlsCredentials(cfg.TLS)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer stopWatch()
+		opts = append(opts, greeter.WithServerOptions(grpc.Creds(creds)))
+	}
+	s, err := greeter.NewServer(opts...)
+	if err != nil {
+		log.Fatal(err)
+	}
+	registerHealthMetrics(metricsRegistry, s.Health(), cfg.HealthServices)
 
-	//ヘルスチェック
-	healthSrv := health.NewServer()
-	healthpb.RegisterHealthServer(s, healthSrv)
-	//mygrpcと呼ぶことでヘルスステータスを確認できる
-	healthSrv.SetServingStatus("mygrpc", healthpb.HealthCheckResponse_SERVING)
-	//空白の場合はエラーにする
-	healthSrv.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+	//作成したgRPCserverを稼働させる
+	if err := s.Start(); err != nil {
+		log.Fatal(err)
+	}
 
-	//gRPCサーバーにGreetingServiceを登録
-	hellopb.RegisterGreetingServiceServer(s, NewMyServer())
+	//メトリクスを公開するHTTPserverを稼働させる
+	if cfg.Metrics.Address != "" {
+		metricsSrv := newMetricsServer(cfg.Metrics.Address, metricsRegistry)
+		go func() {
+			logger.Info("start metrics server", "address", cfg.Metrics.Address)
+			if err := metricsSrv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				logger.Error("metrics server stopped", "error", err)
+			}
+		}()
+		defer metricsSrv.Close()
+	}
 
-	//serverリフレクションの設定
-	reflection.Register(s)
+	//SIGHUPを受け取ったら設定を読み込み直してレート制限を入れ替える
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	go reloadOnHangup(hup, limiter, logger)
 
-	//作成したgRPCserverを稼働させる
+	//Ctrl+CかSIGTERMを受け取ったら処理中のRPCを待ってから終了する
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+	sig := <-quit
+	logger.Info("received signal", "signal", sig.String())
+
+	//DrainPeriodだけ待ってから処理中のRPCをTimeoutまで待つ
+	//2回目のシグナルを受け取った場合はすぐに切断する
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.Shutdown.DrainPeriod+cfg.Shutdown.Timeout))
+	defer cancel()
 	go func() {
-		log.Printf("start gRPC server port: %v", port)
-		s.Serve(listener)
+		select {
+		case sig := <-quit:
+			logger.Warn("received second signal, stopping immediately", "signal", sig.String())
+			cancel()
+		case <-ctx.Done():
+		}
 	}()
-
-	//Ctrl+Cが入力されたらGraceful shutdownされるようにする
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, os.Interrupt)
-	<-quit
-	log.Println("stopping gRPC server...")
-	s.GracefulStop()
+	s.Shutdown(ctx)
 }
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"grpctutorial/pkg/auth"
+)
+
+// authインターセプターで検証できるHS256のJWTを作成する
+func main() {
+	secret := flag.String("secret", "", "HMAC secret (same as the server's auth.jwt.secret)")
+	subject := flag.String("sub", "client", "subject")
+	roles := flag.String("roles", "", "comma separated roles")
+	issuer := flag.String("iss", "", "issuer")
+	audience := flag.String("aud", "", "comma separated audiences")
+	ttl := flag.Duration("ttl", time.Hour, "lifetime of the token")
+	flag.Parse()
+
+	if *secret == "" {
+		log.Fatal("-secret is required")
+	}
+
+	now := time.Now()
+	claims := auth.Claims{
+		Subject:   *subject,
+		Issuer:    *issuer,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(*ttl).Unix(),
+	}
+	if *roles != "" {
+		claims.Roles = strings.Split(*roles, ",")
+	}
+	if *audience != "" {
+		claims.Audience = strings.Split(*audience, ",")
+	}
+	token, err := auth.SignJWT([]byte(*secret), claims)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(token)
+}
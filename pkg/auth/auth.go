@@ -0,0 +1,93 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"strings"
+
+	"google.golang.org/grpc/metadata"
+)
+
+var (
+	ErrMissingToken     = errors.New("missing bearer token")
+	ErrInvalidToken     = errors.New("invalid token")
+	ErrPermissionDenied = errors.New("permission denied")
+)
+
+// 認証された呼び出し元
+type Identity struct {
+	//呼び出し元の名前
+	Subject string
+	//呼び出し元のロール
+	Roles []string
+	//認証方法 "apikey" か "jwt"
+	Method string
+}
+
+// 指定したロールを持っているか
+func (id *Identity) HasRole(role string) bool {
+	for _, r := range id.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+type identityKey struct{}
+
+// ctxに呼び出し元を格納する
+func NewContext(ctx context.Context, id *Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, id)
+}
+
+// ctxから呼び出し元を取得する
+func FromContext(ctx context.Context) (*Identity, bool) {
+	id, ok := ctx.Value(identityKey{}).(*Identity)
+	return id, ok
+}
+
+// トークンを検証して呼び出し元を返す
+type Authenticator interface {
+	Authenticate(token string) (*Identity, error)
+}
+
+// 複数のAuthenticatorを順に試す
+type Authenticators []Authenticator
+
+func (as Authenticators) Authenticate(token string) (*Identity, error) {
+	for _, a := range as {
+		if id, err := a.Authenticate(token); err == nil {
+			return id, nil
+		}
+	}
+	return nil, ErrInvalidToken
+}
+
+// 固定のAPIキー
+// キーと、そのキーで認証される呼び出し元の組
+type StaticKeys map[string]Identity
+
+func (k StaticKeys) Authenticate(token string) (*Identity, error) {
+	//キーの比較は時間が一定になるようにする
+	for key, id := range k {
+		if subtle.ConstantTimeCompare([]byte(key), []byte(token)) == 1 {
+			id := id
+			id.Method = "apikey"
+			return &id, nil
+		}
+	}
+	return nil, ErrInvalidToken
+}
+
+// メタデータの "authorization: Bearer <token>" からトークンを取り出す
+func TokenFromMetadata(md metadata.MD) (string, error) {
+	for _, v := range md.Get("authorization") {
+		scheme, token, ok := strings.Cut(v, " ")
+		if ok && strings.EqualFold(scheme, "bearer") && token != "" {
+			return strings.TrimSpace(token), nil
+		}
+	}
+	return "", ErrMissingToken
+}
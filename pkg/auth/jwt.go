@@ -0,0 +1,168 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// JWTのペイロード
+type Claims struct {
+	Subject   string   `json:"sub"`
+	Issuer    string   `json:"iss,omitempty"`
+	Audience  Audience `json:"aud,omitempty"`
+	ExpiresAt int64    `json:"exp,omitempty"`
+	NotBefore int64    `json:"nbf,omitempty"`
+	IssuedAt  int64    `json:"iat,omitempty"`
+	Roles     []string `json:"roles,omitempty"`
+}
+
+// JWTのaud
+// RFC 7519では1つの文字列か文字列の配列のどちらでもよいので、両方を読めるようにする
+type Audience []string
+
+// 1つだけなら文字列、複数なら配列で書き出す
+func (a Audience) MarshalJSON() ([]byte, error) {
+	if len(a) == 1 {
+		return json.Marshal(a[0])
+	}
+	return json.Marshal([]string(a))
+}
+
+func (a *Audience) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*a = Audience{s}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(b, &list); err != nil {
+		return errors.New("aud must be a string or an array of strings")
+	}
+	*a = list
+	return nil
+}
+
+// audienceを含むか
+func (a Audience) Contains(audience string) bool {
+	for _, s := range a {
+		if s == audience {
+			return true
+		}
+	}
+	return false
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ,omitempty"`
+}
+
+// HS256で署名されたJWTを外部に問い合わせずに検証する
+type JWTVerifier struct {
+	Secret []byte
+	//空でなければissと一致する必要がある
+	Issuer string
+	//空でなければaudに含まれる必要がある
+	Audience string
+	//exp・nbfの許容誤差
+	Leeway time.Duration
+
+	//現在時刻 nilならtime.Now
+	Now func() time.Time
+}
+
+func (v *JWTVerifier) Authenticate(token string) (*Identity, error) {
+	claims, err := v.Verify(token)
+	if err != nil {
+		return nil, err
+	}
+	return &Identity{Subject: claims.Subject, Roles: claims.Roles, Method: "jwt"}, nil
+}
+
+// 署名と有効期限を検証してペイロードを返す
+func (v *JWTVerifier) Verify(token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed jwt", ErrInvalidToken)
+	}
+
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, err
+	}
+	//alg: none などで署名検証を回避されないようにHS256のみ受け付ける
+	if header.Alg != "HS256" {
+		return nil, fmt.Errorf("%w: unsupported alg %q", ErrInvalidToken, header.Alg)
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed signature", ErrInvalidToken)
+	}
+	if !hmac.Equal(sig, sign(v.Secret, parts[0]+"."+parts[1])) {
+		return nil, fmt.Errorf("%w: signature mismatch", ErrInvalidToken)
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if v.Now != nil {
+		now = v.Now()
+	}
+	if claims.ExpiresAt != 0 && now.After(time.Unix(claims.ExpiresAt, 0).Add(v.Leeway)) {
+		return nil, fmt.Errorf("%w: token expired", ErrInvalidToken)
+	}
+	if claims.NotBefore != 0 && now.Before(time.Unix(claims.NotBefore, 0).Add(-v.Leeway)) {
+		return nil, fmt.Errorf("%w: token not valid yet", ErrInvalidToken)
+	}
+	if v.Issuer != "" && claims.Issuer != v.Issuer {
+		return nil, fmt.Errorf("%w: unexpected issuer %q", ErrInvalidToken, claims.Issuer)
+	}
+	if v.Audience != "" && !claims.Audience.Contains(v.Audience) {
+		return nil, fmt.Errorf("%w: unexpected audience %q", ErrInvalidToken, []string(claims.Audience))
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: missing subject", ErrInvalidToken)
+	}
+	return &claims, nil
+}
+
+// HS256で署名したJWTを作成する
+func SignJWT(secret []byte, claims Claims) (string, error) {
+	header, err := json.Marshal(jwtHeader{Alg: "HS256", Typ: "JWT"})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sign(secret, signingInput)), nil
+}
+
+func sign(secret []byte, signingInput string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(signingInput))
+	return mac.Sum(nil)
+}
+
+func decodeSegment(seg string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return fmt.Errorf("%w: malformed segment", ErrInvalidToken)
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	return nil
+}
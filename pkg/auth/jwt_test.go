@@ -0,0 +1,227 @@
+package auth_test
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"grpctutorial/pkg/auth"
+)
+
+var secret = []byte("test-secret")
+
+// 検証の基準にする時刻
+var now = time.Unix(1700000000, 0)
+
+// headerとpayloadをそのままJSONにして、secretで署名したトークンを作る
+// secretがnilなら署名を空にする
+func rawToken(t *testing.T, header, payload interface{}, secret []byte) string {
+	t.Helper()
+	h, err := json.Marshal(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	input := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(p)
+	if secret == nil {
+		return input + "."
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(input))
+	return input + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func signed(t *testing.T, claims auth.Claims) string {
+	t.Helper()
+	token, err := auth.SignJWT(secret, claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestJWTVerifier(t *testing.T) {
+	verifier := &auth.JWTVerifier{
+		Secret:   secret,
+		Issuer:   "issuer",
+		Audience: "greeter",
+		Leeway:   time.Minute,
+		Now:      func() time.Time { return now },
+	}
+	valid := auth.Claims{Subject: "alice", Issuer: "issuer", Audience: auth.Audience{"greeter"}, Roles: []string{"admin"}}
+	with := func(modify func(c *auth.Claims)) auth.Claims {
+		c := valid
+		modify(&c)
+		return c
+	}
+	tests := []struct {
+		name  string
+		token func(t *testing.T) string
+		//nilなら検証に成功する
+		wantErr error
+	}{
+		{
+			name:  "valid token",
+			token: func(t *testing.T) string { return signed(t, valid) },
+		},
+		{
+			name: "alg none",
+			token: func(t *testing.T) string {
+				return rawToken(t, map[string]string{"alg": "none"}, valid, nil)
+			},
+			wantErr: auth.ErrInvalidToken,
+		},
+		{
+			//HS256の鍵で署名しても、algが違えば受け付けない
+			name: "wrong algorithm",
+			token: func(t *testing.T) string {
+				return rawToken(t, map[string]string{"alg": "HS512", "typ": "JWT"}, valid, secret)
+			},
+			wantErr: auth.ErrInvalidToken,
+		},
+		{
+			name: "signed with another secret",
+			token: func(t *testing.T) string {
+				return rawToken(t, map[string]string{"alg": "HS256"}, valid, []byte("other-secret"))
+			},
+			wantErr: auth.ErrInvalidToken,
+		},
+		{
+			name: "payload changed after signing",
+			token: func(t *testing.T) string {
+				good := rawToken(t, map[string]string{"alg": "HS256"}, valid, secret)
+				forged := rawToken(t, map[string]string{"alg": "HS256"}, with(func(c *auth.Claims) { c.Subject = "mallory" }), secret)
+				//forgedのヘッダーとペイロードにgoodの署名を付ける
+				return forged[:strings.LastIndex(forged, ".")] + good[strings.LastIndex(good, "."):]
+			},
+			wantErr: auth.ErrInvalidToken,
+		},
+		{
+			name:    "malformed token",
+			token:   func(t *testing.T) string { return "not.a.jwt.token" },
+			wantErr: auth.ErrInvalidToken,
+		},
+		{
+			name: "expired within leeway",
+			token: func(t *testing.T) string {
+				return signed(t, with(func(c *auth.Claims) { c.ExpiresAt = now.Add(-30 * time.Second).Unix() }))
+			},
+		},
+		{
+			name: "expired beyond leeway",
+			token: func(t *testing.T) string {
+				return signed(t, with(func(c *auth.Claims) { c.ExpiresAt = now.Add(-2 * time.Minute).Unix() }))
+			},
+			wantErr: auth.ErrInvalidToken,
+		},
+		{
+			name: "not valid yet within leeway",
+			token: func(t *testing.T) string {
+				return signed(t, with(func(c *auth.Claims) { c.NotBefore = now.Add(30 * time.Second).Unix() }))
+			},
+		},
+		{
+			name: "not valid yet beyond leeway",
+			token: func(t *testing.T) string {
+				return signed(t, with(func(c *auth.Claims) { c.NotBefore = now.Add(2 * time.Minute).Unix() }))
+			},
+			wantErr: auth.ErrInvalidToken,
+		},
+		{
+			name: "issuer mismatch",
+			token: func(t *testing.T) string {
+				return signed(t, with(func(c *auth.Claims) { c.Issuer = "someone-else" }))
+			},
+			wantErr: auth.ErrInvalidToken,
+		},
+		{
+			name: "audience mismatch",
+			token: func(t *testing.T) string {
+				return signed(t, with(func(c *auth.Claims) { c.Audience = auth.Audience{"billing"} }))
+			},
+			wantErr: auth.ErrInvalidToken,
+		},
+		{
+			name: "audience as an array",
+			token: func(t *testing.T) string {
+				return rawToken(t, map[string]string{"alg": "HS256"},
+					map[string]interface{}{"sub": "alice", "iss": "issuer", "aud": []string{"billing", "greeter"}}, secret)
+			},
+		},
+		{
+			name: "audience as a string",
+			token: func(t *testing.T) string {
+				return rawToken(t, map[string]string{"alg": "HS256"},
+					map[string]interface{}{"sub": "alice", "iss": "issuer", "aud": "greeter"}, secret)
+			},
+		},
+		{
+			name: "audience of the wrong type",
+			token: func(t *testing.T) string {
+				return rawToken(t, map[string]string{"alg": "HS256"},
+					map[string]interface{}{"sub": "alice", "iss": "issuer", "aud": 1}, secret)
+			},
+			wantErr: auth.ErrInvalidToken,
+		},
+		{
+			name: "missing subject",
+			token: func(t *testing.T) string {
+				return signed(t, with(func(c *auth.Claims) { c.Subject = "" }))
+			},
+			wantErr: auth.ErrInvalidToken,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, err := verifier.Authenticate(tt.token(t))
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Authenticate() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if id.Subject != "alice" || id.Method != "jwt" {
+				t.Errorf("identity = %+v, want subject alice by jwt", id)
+			}
+		})
+	}
+}
+
+// 1つのaudは文字列のまま書き出し、読み戻せる
+func TestAudienceJSON(t *testing.T) {
+	tests := []struct {
+		aud  auth.Audience
+		want string
+	}{
+		{aud: auth.Audience{"greeter"}, want: `"greeter"`},
+		{aud: auth.Audience{"greeter", "billing"}, want: `["greeter","billing"]`},
+	}
+	for _, tt := range tests {
+		b, err := json.Marshal(tt.aud)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != tt.want {
+			t.Errorf("Marshal(%q) = %s, want %s", []string(tt.aud), b, tt.want)
+		}
+		var got auth.Audience
+		if err := json.Unmarshal(b, &got); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, tt.aud) {
+			t.Errorf("Unmarshal(%s) = %q, want %q", b, []string(got), []string(tt.aud))
+		}
+	}
+}
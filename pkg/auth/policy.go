@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"fmt"
+	"strings"
+)
+
+// メソッド1つ分の認可ルール
+type Rule struct {
+	//trueなら認証なしで呼び出せる
+	Public bool `yaml:"public" json:"public"`
+	//空でなければ、いずれかのロールを持つ呼び出し元だけ許可する
+	AllowRoles []string `yaml:"allow_roles" json:"allow_roles"`
+	//いずれかのロールを持つ呼び出し元は拒否する
+	DenyRoles []string `yaml:"deny_roles" json:"deny_roles"`
+}
+
+// 呼び出し元がルールを満たすか確認する
+func (r Rule) Authorize(id *Identity) error {
+	for _, role := range r.DenyRoles {
+		if id.HasRole(role) {
+			return fmt.Errorf("%w: role %q is denied", ErrPermissionDenied, role)
+		}
+	}
+	if len(r.AllowRoles) == 0 {
+		return nil
+	}
+	for _, role := range r.AllowRoles {
+		if id.HasRole(role) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: requires one of roles %v", ErrPermissionDenied, r.AllowRoles)
+}
+
+// FullMethod毎の認可ルール
+type Policy struct {
+	//Methodsに一致しないメソッドのルール
+	Default Rule `yaml:"default" json:"default"`
+	//キーは "/myapp.GreetingService/Hello" のようなFullMethod
+	//"/grpc.health.v1.Health/" のように/で終わるキーはサービス全体に一致する
+	Methods map[string]Rule `yaml:"methods" json:"methods"`
+}
+
+// FullMethodに一致するルールを返す
+// 完全一致、サービス単位の一致、Defaultの順に探す
+func (p *Policy) Rule(fullMethod string) Rule {
+	if r, ok := p.Methods[fullMethod]; ok {
+		return r
+	}
+	if i := strings.LastIndex(fullMethod, "/"); i > 0 {
+		if r, ok := p.Methods[fullMethod[:i+1]]; ok {
+			return r
+		}
+	}
+	return p.Default
+}
@@ -0,0 +1,67 @@
+package auth_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"grpctutorial/pkg/auth"
+)
+
+func TestRuleAuthorize(t *testing.T) {
+	tests := []struct {
+		name  string
+		rule  auth.Rule
+		roles []string
+		//nilなら許可される
+		wantErr error
+	}{
+		{name: "no roles required", rule: auth.Rule{}},
+		{name: "has an allowed role", rule: auth.Rule{AllowRoles: []string{"admin", "user"}}, roles: []string{"user"}},
+		{name: "lacks the allowed roles", rule: auth.Rule{AllowRoles: []string{"admin"}}, roles: []string{"user"}, wantErr: auth.ErrPermissionDenied},
+		{name: "has a denied role", rule: auth.Rule{DenyRoles: []string{"banned"}}, roles: []string{"user", "banned"}, wantErr: auth.ErrPermissionDenied},
+		{
+			//拒否するロールは許可するロールより優先される
+			name:    "denied role wins over allowed role",
+			rule:    auth.Rule{AllowRoles: []string{"admin"}, DenyRoles: []string{"banned"}},
+			roles:   []string{"admin", "banned"},
+			wantErr: auth.ErrPermissionDenied,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.rule.Authorize(&auth.Identity{Subject: "alice", Roles: tt.roles})
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Authorize() = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPolicyRule(t *testing.T) {
+	policy := &auth.Policy{
+		Default: auth.Rule{AllowRoles: []string{"user"}},
+		Methods: map[string]auth.Rule{
+			"/grpc.health.v1.Health/":               {Public: true},
+			"/myapp.GreetingService/":               {AllowRoles: []string{"greeter"}},
+			"/myapp.GreetingService/HelloBiStreams": {AllowRoles: []string{"admin"}},
+		},
+	}
+	tests := []struct {
+		method string
+		want   auth.Rule
+	}{
+		{method: "/myapp.GreetingService/HelloBiStreams", want: auth.Rule{AllowRoles: []string{"admin"}}},
+		{method: "/myapp.GreetingService/Hello", want: auth.Rule{AllowRoles: []string{"greeter"}}},
+		{method: "/grpc.health.v1.Health/Check", want: auth.Rule{Public: true}},
+		{method: "/other.Service/Call", want: auth.Rule{AllowRoles: []string{"user"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			got := policy.Rule(tt.method)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Rule(%q) = %+v, want %+v", tt.method, got, tt.want)
+			}
+		})
+	}
+}
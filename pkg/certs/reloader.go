@@ -0,0 +1,186 @@
+package certs
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// 証明書ファイルを監視し、変更されたら読み直す
+// 読み直した証明書は新しいハンドシェイクから使われるため、接続済みのストリームは切断されない
+type Reloader struct {
+	certFile string
+	keyFile  string
+	caFile   string
+
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+	clientCA *x509.CertPool
+	modTimes [3]time.Time
+}
+
+// 証明書と秘密鍵、クライアント証明書検証用のCAバンドル(省略可)を読み込む
+func NewReloader(certFile, keyFile, caFile string) (*Reloader, error) {
+	r := &Reloader{certFile: certFile, keyFile: keyFile, caFile: caFile}
+	if _, err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// ファイルの更新時刻が変わっていれば読み直す
+// 読み込みに失敗した場合は以前の証明書を使い続ける
+func (r *Reloader) Reload() (bool, error) {
+	modTimes, err := r.stat()
+	if err != nil {
+		return false, err
+	}
+	r.mu.RLock()
+	changed := modTimes != r.modTimes
+	r.mu.RUnlock()
+	if !changed {
+		return false, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return false, fmt.Errorf("load key pair: %w", err)
+	}
+	var pool *x509.CertPool
+	if r.caFile != "" {
+		if pool, err = LoadCertPool(r.caFile); err != nil {
+			return false, err
+		}
+	}
+
+	r.mu.Lock()
+	r.cert = &cert
+	r.clientCA = pool
+	r.modTimes = modTimes
+	r.mu.Unlock()
+	return true, nil
+}
+
+func (r *Reloader) stat() ([3]time.Time, error) {
+	var modTimes [3]time.Time
+	for i, name := range []string{r.certFile, r.keyFile, r.caFile} {
+		if name == "" {
+			continue
+		}
+		fi, err := os.Stat(name)
+		if err != nil {
+			return modTimes, err
+		}
+		modTimes[i] = fi.ModTime()
+	}
+	return modTimes, nil
+}
+
+// ctxが終了するまでinterval毎にファイルの変更を確認する
+func (r *Reloader) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reloaded, err := r.Reload()
+			if err != nil {
+				log.Printf("reload certificates: %v", err)
+			} else if reloaded {
+				log.Printf("reloaded certificates: %s", r.certFile)
+			}
+		}
+	}
+}
+
+// tls.Config.GetCertificateに渡す
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// クライアント証明書を検証するCAバンドル
+func (r *Reloader) ClientCAs() *x509.CertPool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.clientCA
+}
+
+// ハンドシェイク毎に最新の証明書とCAバンドルを使うserver用のtls.Configを作る
+func (r *Reloader) ServerConfig(clientAuth tls.ClientAuthType) *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			//返したtls.Configが外側の設定の代わりに使われるので、credentials.NewTLSが付けるALPNもここで指定する
+			return &tls.Config{
+				MinVersion:     tls.VersionTLS12,
+				NextProtos:     []string{"h2"},
+				GetCertificate: r.GetCertificate,
+				ClientAuth:     clientAuth,
+				ClientCAs:      r.ClientCAs(),
+			}, nil
+		},
+	}
+}
+
+// client用のtls.Configを作る
+// caFileを省略するとシステムのルート証明書を使い、certFileとkeyFileを指定するとクライアント証明書を送る
+func ClientConfig(caFile, certFile, keyFile, serverName string) (*tls.Config, error) {
+	cfg := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: serverName,
+	}
+	if caFile != "" {
+		pool, err := LoadCertPool(caFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = pool
+	}
+	if (certFile == "") != (keyFile == "") {
+		return nil, errors.New("client certificate and key must be specified together")
+	}
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load key pair: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+// PEM形式のCAバンドルを読み込む
+func LoadCertPool(caFile string) (*x509.CertPool, error) {
+	b, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("load CA bundle: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(b) {
+		return nil, fmt.Errorf("load CA bundle: no certificates found in %s", caFile)
+	}
+	return pool, nil
+}
+
+// 設定ファイルでの表記からtls.ClientAuthTypeに変換する
+func ParseClientAuth(s string) (tls.ClientAuthType, error) {
+	switch s {
+	case "", "none":
+		return tls.NoClientCert, nil
+	case "request":
+		return tls.VerifyClientCertIfGiven, nil
+	case "require":
+		return tls.RequireAndVerifyClientCert, nil
+	}
+	return tls.NoClientCert, fmt.Errorf("unknown client auth %q (none, request or require)", s)
+}
@@ -0,0 +1,289 @@
+package certs_test
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"grpctutorial/pkg/certs"
+	hellopb "grpctutorial/pkg/grpc"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// server証明書のSAN
+var hosts = []string{"localhost", "127.0.0.1"}
+
+// dirにテスト用のPKIを作る
+func generate(t *testing.T, dir string) *certs.PKI {
+	t.Helper()
+	p, err := certs.GeneratePKI(dir, hosts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// dirに新しいCAでPKIを作り直し、rに読み直させる
+func rotate(t *testing.T, r *certs.Reloader, dir string) *certs.PKI {
+	t.Helper()
+	p := generate(t, dir)
+	//更新時刻で変更を検出するので、確実に変わるように進める
+	future := time.Now().Add(time.Hour)
+	for _, name := range []string{p.CAFile, p.ServerCertFile, p.ServerKeyFile} {
+		if err := os.Chtimes(name, future, future); err != nil {
+			t.Fatal(err)
+		}
+	}
+	reloaded, err := r.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reloaded {
+		t.Fatal("Reload did not detect the new certificates")
+	}
+	return p
+}
+
+// nameを別の場所にコピーし、そのパスを返す
+func keep(t *testing.T, name string) string {
+	t.Helper()
+	b, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst := filepath.Join(t.TempDir(), filepath.Base(name))
+	if err := os.WriteFile(dst, b, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return dst
+}
+
+// Reloaderの証明書で待ち受けるgRPCserverを起動し、アドレスを返す
+func serve(t *testing.T, r *certs.Reloader, clientAuth tls.ClientAuthType) string {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := grpc.NewServer(grpc.Creds(credentials.NewTLS(r.ServerConfig(clientAuth))))
+	healthpb.RegisterHealthServer(srv, health.NewServer())
+	hellopb.RegisterGreetingServiceServer(srv, echoServer{})
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+	return lis.Addr().String()
+}
+
+// HelloBiStreamsで受け取った名前をそのまま返す
+type echoServer struct {
+	hellopb.UnimplementedGreetingServiceServer
+}
+
+func (echoServer) HelloBiStreams(stream hellopb.GreetingService_HelloBiStreamsServer) error {
+	for {
+		req, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := stream.Send(&hellopb.HelloResponse{Message: req.GetName()}); err != nil {
+			return err
+		}
+	}
+}
+
+// ClientConfigで接続してヘルスチェックを呼び、ステータスコードを返す
+func check(t *testing.T, addr, caFile, certFile, keyFile string) codes.Code {
+	t.Helper()
+	cfg, err := certs.ClientConfig(caFile, certFile, keyFile, "localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(credentials.NewTLS(cfg)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err = healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+	return status.Code(err)
+}
+
+func TestReloaderHandshake(t *testing.T) {
+	p := generate(t, t.TempDir())
+	//別のCAで署名した証明書
+	other := generate(t, t.TempDir())
+	tests := []struct {
+		name       string
+		clientAuth tls.ClientAuthType
+		//クライアントが使うファイル
+		caFile, certFile, keyFile string
+
+		want codes.Code
+	}{
+		{
+			name:       "TLS",
+			clientAuth: tls.NoClientCert,
+			caFile:     p.CAFile,
+			want:       codes.OK,
+		},
+		{
+			name:       "TLS with an untrusted server certificate",
+			clientAuth: tls.NoClientCert,
+			caFile:     other.CAFile,
+			want:       codes.Unavailable,
+		},
+		{
+			name:       "mTLS",
+			clientAuth: tls.RequireAndVerifyClientCert,
+			caFile:     p.CAFile,
+			certFile:   p.ClientCertFile,
+			keyFile:    p.ClientKeyFile,
+			want:       codes.OK,
+		},
+		{
+			name:       "mTLS without a client certificate",
+			clientAuth: tls.RequireAndVerifyClientCert,
+			caFile:     p.CAFile,
+			want:       codes.Unavailable,
+		},
+		{
+			name:       "mTLS with an untrusted client certificate",
+			clientAuth: tls.RequireAndVerifyClientCert,
+			caFile:     p.CAFile,
+			certFile:   other.ClientCertFile,
+			keyFile:    other.ClientKeyFile,
+			want:       codes.Unavailable,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := certs.NewReloader(p.ServerCertFile, p.ServerKeyFile, p.CAFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			addr := serve(t, r, tt.clientAuth)
+			if got := check(t, addr, tt.caFile, tt.certFile, tt.keyFile); got != tt.want {
+				t.Errorf("status = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// 証明書を作り直すと、serverを止めずに新しいハンドシェイクから使われる
+func TestReloaderReload(t *testing.T) {
+	dir := t.TempDir()
+	old := generate(t, dir)
+	//古いCAとクライアント証明書を別の場所に残しておく
+	oldCA, oldCert, oldKey := keep(t, old.CAFile), keep(t, old.ClientCertFile), keep(t, old.ClientKeyFile)
+
+	r, err := certs.NewReloader(old.ServerCertFile, old.ServerKeyFile, old.CAFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := serve(t, r, tls.RequireAndVerifyClientCert)
+	if got := check(t, addr, oldCA, oldCert, oldKey); got != codes.OK {
+		t.Fatalf("before reload: status = %s, want %s", got, codes.OK)
+	}
+
+	p := rotate(t, r, dir)
+	if got := check(t, addr, p.CAFile, p.ClientCertFile, p.ClientKeyFile); got != codes.OK {
+		t.Errorf("new CA: status = %s, want %s", got, codes.OK)
+	}
+	if got := check(t, addr, oldCA, oldCert, oldKey); got != codes.Unavailable {
+		t.Errorf("old CA: status = %s, want %s", got, codes.Unavailable)
+	}
+
+	//変更がなければ読み直さない
+	if reloaded, err := r.Reload(); err != nil || reloaded {
+		t.Errorf("Reload() = %t, %v, want false, nil", reloaded, err)
+	}
+}
+
+// 証明書を作り直す前に開いたストリームは、読み直した後も送受信できる
+func TestReloaderKeepsStreams(t *testing.T) {
+	dir := t.TempDir()
+	p := generate(t, dir)
+	r, err := certs.NewReloader(p.ServerCertFile, p.ServerKeyFile, p.CAFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := serve(t, r, tls.RequireAndVerifyClientCert)
+	cfg, err := certs.ClientConfig(p.CAFile, p.ClientCertFile, p.ClientKeyFile, "localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(credentials.NewTLS(cfg)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	stream, err := hellopb.NewGreetingServiceClient(conn).HelloBiStreams(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	echo := func(name string) {
+		t.Helper()
+		if err := stream.Send(&hellopb.HelloRequest{Name: name}); err != nil {
+			t.Fatal(err)
+		}
+		res, err := stream.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.GetMessage() != name {
+			t.Errorf("message = %q, want %q", res.GetMessage(), name)
+		}
+	}
+	echo("before")
+
+	//接続は古い証明書でハンドシェイク済みなので、そのまま使い続けられる
+	rotate(t, r, dir)
+	echo("after")
+
+	if err := stream.CloseSend(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stream.Recv(); !errors.Is(err, io.EOF) {
+		t.Errorf("Recv after CloseSend = %v, want io.EOF", err)
+	}
+}
+
+// ハンドシェイクでALPNのh2を返す
+func TestServerConfigALPN(t *testing.T) {
+	p := generate(t, t.TempDir())
+	r, err := certs.NewReloader(p.ServerCertFile, p.ServerKeyFile, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := serve(t, r, tls.NoClientCert)
+	cfg, err := certs.ClientConfig(p.CAFile, "", "", "localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.NextProtos = []string{"h2"}
+	conn, err := tls.Dial("tcp", addr, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if got := conn.ConnectionState().NegotiatedProtocol; got != "h2" {
+		t.Errorf("negotiated protocol = %q, want h2", got)
+	}
+}
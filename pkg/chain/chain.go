@@ -0,0 +1,120 @@
+package chain
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// 設定ファイルで指定するインターセプター1つ分
+type Spec struct {
+	Name    string
+	Options Options
+}
+
+// 名前から指定して作れるものの登録先
+// Tにはserverやclientのインターセプターの組を指定する
+type Registry[T any] struct {
+	factories map[string]func(Options) (T, error)
+}
+
+func NewRegistry[T any]() *Registry[T] {
+	return &Registry[T]{factories: make(map[string]func(Options) (T, error))}
+}
+
+// nameでfactoryを登録する
+// 同じ名前を2回登録するとpanicする
+func (r *Registry[T]) Register(name string, factory func(Options) (T, error)) {
+	if _, ok := r.factories[name]; ok {
+		panic(fmt.Sprintf("chain: %q is already registered", name))
+	}
+	r.factories[name] = factory
+}
+
+// 登録されている名前の一覧
+func (r *Registry[T]) Names() []string {
+	names := make([]string, 0, len(r.factories))
+	for name := range r.factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// specsの順にfactoryを呼び出して並べる
+func (r *Registry[T]) Build(specs []Spec) ([]T, error) {
+	built := make([]T, 0, len(specs))
+	for _, spec := range specs {
+		factory, ok := r.factories[spec.Name]
+		if !ok {
+			return nil, fmt.Errorf("unknown interceptor %q (available: %v)", spec.Name, r.Names())
+		}
+		v, err := factory(spec.Options)
+		if err != nil {
+			return nil, fmt.Errorf("interceptor %q: %w", spec.Name, err)
+		}
+		built = append(built, v)
+	}
+	return built, nil
+}
+
+// インターセプターのUnary版とStream版の組
+// U, Sにはserverかclientのインターセプターの型を指定する
+// どちらかがnilの場合、その種類のRPCには適用されない
+type Interceptor[U, S any] struct {
+	Unary  U
+	Stream S
+}
+
+// 先頭が一番外側になるように並べたインターセプター
+type Chain[U, S any] []Interceptor[U, S]
+
+// specsの順にインターセプターを作ってChainにする
+func Build[U, S any](r *Registry[Interceptor[U, S]], specs []Spec) (Chain[U, S], error) {
+	c, err := r.Build(specs)
+	return Chain[U, S](c), err
+}
+
+// nilを除いたUnaryインターセプターを並べた順に返す
+func (c Chain[U, S]) Unaries() []U {
+	unaries := make([]U, 0, len(c))
+	for _, i := range c {
+		if !isNil(i.Unary) {
+			unaries = append(unaries, i.Unary)
+		}
+	}
+	return unaries
+}
+
+// nilを除いたStreamインターセプターを並べた順に返す
+func (c Chain[U, S]) Streams() []S {
+	streams := make([]S, 0, len(c))
+	for _, i := range c {
+		if !isNil(i.Stream) {
+			streams = append(streams, i.Stream)
+		}
+	}
+	return streams
+}
+
+// インターセプターの型は関数なので、型パラメーターのままではnilと比較できない
+func isNil[T any](v T) bool {
+	return reflect.ValueOf(&v).Elem().IsZero()
+}
+
+// factoryに渡される設定値
+type Options map[string]string
+
+// known以外のキーが指定されていればエラーを返す
+func (o Options) Check(known ...string) error {
+	for key := range o {
+		found := false
+		for _, k := range known {
+			found = found || k == key
+		}
+		if !found {
+			return fmt.Errorf("unknown option %q", key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package Interceptors
+
+import (
+	"grpctutorial/pkg/chain"
+	"grpctutorial/pkg/tracing"
+
+	"google.golang.org/grpc"
+)
+
+// clientのインターセプターのUnary版とStream版の組
+type Interceptor = chain.Interceptor[grpc.UnaryClientInterceptor, grpc.StreamClientInterceptor]
+
+// 名前からInterceptorを作るfactoryの登録先
+type Registry = chain.Registry[Interceptor]
+
+// client用のインターセプターを登録したRegistryを返す
+func NewRegistry() *Registry {
+	r := chain.NewRegistry[Interceptor]()
+	r.Register("example", func(opts chain.Options) (Interceptor, error) {
+		if err := opts.Check(); err != nil {
+			return Interceptor{}, err
+		}
+		return Interceptor{Unary: MyUnaryClientInteceptor1, Stream: MyStreamClientInteceptor1}, nil
+	})
+	return r
+}
+
+// tracingインターセプターのfactory
+func TracingFactory(tracer *tracing.Tracer) func(chain.Options) (Interceptor, error) {
+	return func(opts chain.Options) (Interceptor, error) {
+		if err := opts.Check(); err != nil {
+			return Interceptor{}, err
+		}
+		return Interceptor{Unary: TracingUnaryClientInterceptor(tracer), Stream: TracingStreamClientInterceptor(tracer)}, nil
+	}
+}
+
+// 先頭が一番外側になるように並べたインターセプター
+type Chain = chain.Chain[grpc.UnaryClientInterceptor, grpc.StreamClientInterceptor]
+
+// grpc.Dialに渡すオプション
+func DialOptions(c Chain) []grpc.DialOption {
+	return []grpc.DialOption{
+		grpc.WithChainUnaryInterceptor(c.Unaries()...),
+		grpc.WithChainStreamInterceptor(c.Streams()...),
+	}
+}
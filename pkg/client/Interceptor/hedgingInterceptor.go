@@ -0,0 +1,208 @@
+package Interceptors
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"grpctutorial/pkg/retry"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// 同じリクエストを時間をずらして並行に送り、最初に成功した応答を使う方法
+// gRPCのservice configのhedgingPolicyと同じ意味
+type HedgingPolicy struct {
+	//最初の呼び出しを含めた最大の試行回数
+	MaxAttempts int
+	//次の試行を始めるまでの待ち時間
+	Delay time.Duration
+	//このコードで失敗した場合は他の試行を続け、次の試行をすぐに始める
+	//それ以外のコードで失敗すると全ての試行を取り消してそのエラーを返す
+	NonFatalCodes []codes.Code
+}
+
+// FullMethod毎のHedgingPolicy
+// キーは "/myapp.GreetingService/Hello" のようなFullMethodか、"/myapp.GreetingService/" のようなサービス全体
+type HedgingPolicies map[string]HedgingPolicy
+
+func (p HedgingPolicies) lookup(method string) (HedgingPolicy, bool) {
+	if policy, ok := p[method]; ok {
+		return policy, true
+	}
+	if i := strings.LastIndex(method, "/"); i > 0 {
+		if policy, ok := p[method[:i+1]]; ok {
+			return policy, true
+		}
+	}
+	return HedgingPolicy{}, false
+}
+
+// Unary RPCをヘッジングするインターセプター
+// grpc-goはservice configのhedgingPolicyに対応していないので、ここで試行を並行に送る
+// serverがgrpc-retry-pushback-msを返した場合は、その時間だけ次の試行を遅らせる(負の値なら以降の試行をやめる)
+func HedgingUnaryClientInterceptor(policies HedgingPolicies) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, res interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		policy, ok := policies.lookup(method)
+		reply, isProto := res.(proto.Message)
+		if !ok || policy.MaxAttempts < 2 || !isProto {
+			return invoker(ctx, method, req, res, cc, opts...)
+		}
+		h := &hedge{policy: policy, method: method, req: req, cc: cc, invoker: invoker}
+		h.splitOptions(opts)
+		return h.run(ctx, reply)
+	}
+}
+
+// 1回のヘッジングの状態
+type hedge struct {
+	policy  HedgingPolicy
+	method  string
+	req     interface{}
+	cc      *grpc.ClientConn
+	invoker grpc.UnaryInvoker
+
+	//試行毎に受け取るヘッダー・トレイラー・接続先は並行に書き込まれるので、呼び出し元のオプションとは分けておく
+	opts    []grpc.CallOption
+	header  *metadata.MD
+	trailer *metadata.MD
+	peer    *peer.Peer
+}
+
+// 1回の試行の結果
+type attemptResult struct {
+	res     proto.Message
+	err     error
+	header  metadata.MD
+	trailer metadata.MD
+	peer    peer.Peer
+}
+
+func (h *hedge) splitOptions(opts []grpc.CallOption) {
+	for _, o := range opts {
+		switch o := o.(type) {
+		case grpc.HeaderCallOption:
+			h.header = o.HeaderAddr
+		case grpc.TrailerCallOption:
+			h.trailer = o.TrailerAddr
+		case grpc.PeerCallOption:
+			h.peer = o.PeerAddr
+		default:
+			h.opts = append(h.opts, o)
+		}
+	}
+}
+
+func (h *hedge) run(ctx context.Context, reply proto.Message) error {
+	ctx, cancel := context.WithCancel(ctx)
+	//終わった時点で残りの試行を取り消す
+	defer cancel()
+
+	results := make(chan *attemptResult, h.policy.MaxAttempts)
+	started, pending := 0, 0
+	//pushbackで負の値を受け取ったら以降の試行を始めない
+	stopped := false
+	canStart := func() bool { return !stopped && started < h.policy.MaxAttempts }
+	start := func() {
+		go h.attempt(ctx, started, reply.ProtoReflect().New().Interface(), results)
+		started++
+		pending++
+	}
+	start()
+
+	next := time.NewTimer(h.policy.Delay)
+	defer next.Stop()
+	var last *attemptResult
+	for pending > 0 || canStart() {
+		select {
+		case r := <-results:
+			pending--
+			last = r
+			if r.err == nil {
+				proto.Merge(reply, r.res)
+				h.copyResult(r)
+				return nil
+			}
+			if !h.nonFatal(r.err) {
+				h.copyResult(r)
+				return r.err
+			}
+			//失敗したら次の試行をすぐに始める serverが待ち時間を指定していればそれに従う
+			delay, ok := pushback(r.trailer)
+			if !ok {
+				stopped = true
+				continue
+			}
+			if !next.Stop() {
+				select {
+				case <-next.C:
+				default:
+				}
+			}
+			next.Reset(delay)
+		case <-next.C:
+			if canStart() {
+				start()
+				next.Reset(h.policy.Delay)
+			}
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		}
+	}
+	h.copyResult(last)
+	return last.err
+}
+
+// n回目(0から数える)の試行
+func (h *hedge) attempt(ctx context.Context, n int, res proto.Message, results chan<- *attemptResult) {
+	if n > 0 {
+		ctx = metadata.AppendToOutgoingContext(ctx, retry.PreviousAttemptsKey, strconv.Itoa(n))
+	}
+	r := &attemptResult{res: res}
+	opts := append([]grpc.CallOption{grpc.Header(&r.header), grpc.Trailer(&r.trailer), grpc.Peer(&r.peer)}, h.opts...)
+	r.err = h.invoker(ctx, h.method, h.req, res, h.cc, opts...)
+	results <- r
+}
+
+func (h *hedge) nonFatal(err error) bool {
+	code := status.Code(err)
+	for _, c := range h.policy.NonFatalCodes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// 採用した試行のヘッダー・トレイラー・接続先を呼び出し元のオプションに書き込む
+func (h *hedge) copyResult(r *attemptResult) {
+	if h.header != nil {
+		*h.header = r.header
+	}
+	if h.trailer != nil {
+		*h.trailer = r.trailer
+	}
+	if h.peer != nil {
+		*h.peer = r.peer
+	}
+}
+
+// トレイラーで指定された次の試行までの待ち時間
+// 指定がなければ0、負の値や不正な値なら以降の試行をやめるのでfalseを返す
+func pushback(trailer metadata.MD) (time.Duration, bool) {
+	v := trailer.Get(retry.PushbackKey)
+	if len(v) == 0 {
+		return 0, true
+	}
+	ms, err := strconv.Atoi(v[0])
+	if err != nil || ms < 0 {
+		return 0, false
+	}
+	return time.Duration(ms) * time.Millisecond, true
+}
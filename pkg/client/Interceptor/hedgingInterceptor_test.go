@@ -0,0 +1,169 @@
+package Interceptors
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"grpctutorial/pkg/retry"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// n回目(0から数える)の試行をどう処理するか
+type attemptFunc func(ctx context.Context, n int) error
+
+// 試行毎にfnを呼ぶserverを起動し、hedgingインターセプターを入れたクライアントを返す
+// attemptsはserverが受け取った試行の数を返す
+func startHedging(t *testing.T, policy HedgingPolicy, fn attemptFunc) (client healthpb.HealthClient, attempts func() int64) {
+	t.Helper()
+	var count atomic.Int64
+	faulty := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		count.Add(1)
+		n := 0
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			if v := md.Get(retry.PreviousAttemptsKey); len(v) > 0 {
+				n, _ = strconv.Atoi(v[0])
+			}
+		}
+		if err := fn(ctx, n); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer(grpc.UnaryInterceptor(faulty))
+	healthpb.RegisterHealthServer(srv, health.NewServer())
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	c := Chain{{Unary: HedgingUnaryClientInterceptor(HedgingPolicies{"/grpc.health.v1.Health/": policy})}}
+	dialOptions := append(DialOptions(c),
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	conn, err := grpc.DialContext(context.Background(), "bufnet", dialOptions...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return healthpb.NewHealthClient(conn), count.Load
+}
+
+// 最初のfailures回の試行をcodeで失敗させる
+// pushbackが空でなければgrpc-retry-pushback-msのトレイラーで返す
+func failFirst(failures int, code codes.Code, pushback string) attemptFunc {
+	return func(ctx context.Context, n int) error {
+		if n >= failures {
+			return nil
+		}
+		if pushback != "" {
+			grpc.SetTrailer(ctx, metadata.Pairs(retry.PushbackKey, pushback))
+		}
+		return status.Errorf(code, "attempt %d failed", n)
+	}
+}
+
+func TestHedgingUnaryClientInterceptor(t *testing.T) {
+	unavailable := []codes.Code{codes.Unavailable}
+	tests := []struct {
+		name    string
+		policy  HedgingPolicy
+		attempt attemptFunc
+		//期待するステータスコードと試行回数
+		wantCode     codes.Code
+		wantAttempts int64
+		//応答までにかかる時間の範囲
+		minElapsed time.Duration
+		maxElapsed time.Duration
+	}{
+		{
+			//最初の試行だけ遅らせると、Delay後に始めた2つ目の試行が先に返る
+			name:   "fastest attempt wins",
+			policy: HedgingPolicy{MaxAttempts: 2, Delay: 50 * time.Millisecond},
+			attempt: func(ctx context.Context, n int) error {
+				if n == 0 {
+					select {
+					case <-time.After(3 * time.Second):
+					case <-ctx.Done():
+						return ctx.Err()
+					}
+				}
+				return nil
+			},
+			wantCode:     codes.OK,
+			wantAttempts: 2,
+			minElapsed:   50 * time.Millisecond,
+			maxElapsed:   time.Second,
+		},
+		{
+			name:         "non-fatal failure starts the next attempt immediately",
+			policy:       HedgingPolicy{MaxAttempts: 3, Delay: 3 * time.Second, NonFatalCodes: unavailable},
+			attempt:      failFirst(1, codes.Unavailable, ""),
+			wantCode:     codes.OK,
+			wantAttempts: 2,
+			maxElapsed:   time.Second,
+		},
+		{
+			name:         "fatal failure stops hedging",
+			policy:       HedgingPolicy{MaxAttempts: 3, Delay: 3 * time.Second},
+			attempt:      failFirst(1, codes.Unavailable, ""),
+			wantCode:     codes.Unavailable,
+			wantAttempts: 1,
+			maxElapsed:   time.Second,
+		},
+		{
+			name:         "last error is returned when every attempt fails",
+			policy:       HedgingPolicy{MaxAttempts: 3, Delay: 10 * time.Millisecond, NonFatalCodes: unavailable},
+			attempt:      failFirst(5, codes.Unavailable, ""),
+			wantCode:     codes.Unavailable,
+			wantAttempts: 3,
+			maxElapsed:   time.Second,
+		},
+		{
+			//失敗してもすぐには始めず、pushbackで指定された時間だけ待つ
+			name:         "pushback delays the next attempt",
+			policy:       HedgingPolicy{MaxAttempts: 3, Delay: 3 * time.Second, NonFatalCodes: unavailable},
+			attempt:      failFirst(1, codes.Unavailable, "300"),
+			wantCode:     codes.OK,
+			wantAttempts: 2,
+			minElapsed:   300 * time.Millisecond,
+			maxElapsed:   time.Second,
+		},
+		{
+			name:         "negative pushback stops further attempts",
+			policy:       HedgingPolicy{MaxAttempts: 3, Delay: 10 * time.Millisecond, NonFatalCodes: unavailable},
+			attempt:      failFirst(5, codes.Unavailable, "-1"),
+			wantCode:     codes.Unavailable,
+			wantAttempts: 1,
+			maxElapsed:   time.Second,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, attempts := startHedging(t, tt.policy, tt.attempt)
+			start := time.Now()
+			_, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{})
+			elapsed := time.Since(start)
+			if got := status.Code(err); got != tt.wantCode {
+				t.Fatalf("status = %s (%v), want %s", got, err, tt.wantCode)
+			}
+			if elapsed < tt.minElapsed || elapsed > tt.maxElapsed {
+				t.Errorf("call took %v, want between %v and %v", elapsed, tt.minElapsed, tt.maxElapsed)
+			}
+			if got := attempts(); got != tt.wantAttempts {
+				t.Errorf("server received %d attempts, want %d", got, tt.wantAttempts)
+			}
+		})
+	}
+}
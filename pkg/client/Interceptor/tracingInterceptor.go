@@ -0,0 +1,98 @@
+package Interceptors
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync/atomic"
+
+	"grpctutorial/pkg/tracing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// RPC毎にclientスパンを作り、traceparentをメタデータでserverに伝搬するUnaryインターセプター
+func TracingUnaryClientInterceptor(tracer *tracing.Tracer) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, res interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		ctx, span := startClientSpan(ctx, tracer, method)
+		tracing.AddMessageEvent(span, tracing.MessageSent, 1)
+
+		var header metadata.MD
+		err := invoker(ctx, method, req, res, cc, append(opts, grpc.Header(&header))...)
+
+		if err == nil {
+			tracing.AddMessageEvent(span, tracing.MessageReceived, 1)
+		}
+		span.SetAttributes(tracing.Strings("rpc.grpc.response.metadata_keys", tracing.MetadataKeys(header)))
+		tracing.EndWithStatus(span, err)
+		return err
+	}
+}
+
+// Stream版のトレーシングインターセプター
+// 送受信したメッセージ毎にイベントを記録し、ストリームが終わった時にスパンを終了する
+func TracingStreamClientInterceptor(tracer *tracing.Tracer) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		ctx, span := startClientSpan(ctx, tracer, method)
+
+		stream, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			tracing.EndWithStatus(span, err)
+			return nil, err
+		}
+		return &tracingClientStream{ClientStream: stream, desc: desc, span: span}, nil
+	}
+}
+
+func startClientSpan(ctx context.Context, tracer *tracing.Tracer, method string) (context.Context, *tracing.Span) {
+	name, attrs := tracing.RPCSpan(method)
+	ctx, span := tracer.Start(ctx, name, tracing.KindClient, attrs...)
+	ctx = tracing.InjectOutgoing(ctx, span)
+	if md, ok := metadata.FromOutgoingContext(ctx); ok {
+		span.SetAttributes(tracing.Strings("rpc.grpc.request.metadata_keys", tracing.MetadataKeys(md)))
+	}
+	return ctx, span
+}
+
+// 送受信したメッセージを記録するストリーム
+type tracingClientStream struct {
+	grpc.ClientStream
+	desc     *grpc.StreamDesc
+	span     *tracing.Span
+	sent     atomic.Int64
+	received atomic.Int64
+}
+
+func (s *tracingClientStream) SendMsg(m interface{}) error {
+	err := s.ClientStream.SendMsg(m)
+	if err == nil {
+		tracing.AddMessageEvent(s.span, tracing.MessageSent, s.sent.Add(1))
+	}
+	return err
+}
+
+func (s *tracingClientStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	switch {
+	case errors.Is(err, io.EOF):
+		//正常に終了した
+		s.end(nil)
+	case err != nil:
+		s.end(err)
+	default:
+		tracing.AddMessageEvent(s.span, tracing.MessageReceived, s.received.Add(1))
+		//serverがストリームでない場合、レスポンスは1つだけなのでここで終了する
+		if !s.desc.ServerStreams {
+			s.end(nil)
+		}
+	}
+	return err
+}
+
+func (s *tracingClientStream) end(err error) {
+	if header, herr := s.ClientStream.Header(); herr == nil {
+		s.span.SetAttributes(tracing.Strings("rpc.grpc.response.metadata_keys", tracing.MetadataKeys(header)))
+	}
+	tracing.EndWithStatus(s.span, err)
+}
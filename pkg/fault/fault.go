@@ -0,0 +1,174 @@
+package fault
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"grpctutorial/pkg/retry"
+	"grpctutorial/pkg/rpcerr"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// 1つのFullMethodに注入する障害
+// Attemptsに達していない試行と、Rateの割合でランダムに選ばれた呼び出しが障害の対象になる
+type Rule struct {
+	//返すステータスコード "UNAVAILABLE" のような名前 空ならUNAVAILABLE、OKなら遅延だけ
+	Code string `yaml:"code" json:"code"`
+	//ステータスのメッセージ 空なら "injected fault"
+	Message string `yaml:"message" json:"message"`
+	//障害を起こす割合 0から1
+	Rate float64 `yaml:"rate" json:"rate"`
+	//それまでの試行回数がこの値より少ない呼び出しは必ず障害の対象にする 1なら最初の試行だけ
+	Attempts int `yaml:"attempts" json:"attempts"`
+	//障害を起こす前に待つ時間 "100ms" のような書式
+	Delay string `yaml:"delay" json:"delay"`
+	//エラーのRetryInfoで伝える、やり直すまでの待ち時間 空ならRetryInfoを付けない
+	Pushback string `yaml:"pushback" json:"pushback"`
+
+	code     codes.Code
+	delay    time.Duration
+	pushback time.Duration
+	//Pushbackが指定されているか
+	hasPushback bool
+}
+
+// FullMethod毎に注入する障害
+type Policy struct {
+	//キーは "/myapp.GreetingService/Hello" のようなFullMethod
+	//"/myapp.GreetingService/" のように/で終わるキーはサービス全体に一致する
+	Methods map[string]Rule `yaml:"methods" json:"methods"`
+}
+
+// ルールが正しいか確認し、コードと時間を解析する
+func (p *Policy) Compile() error {
+	var errs []string
+	for method, r := range p.Methods {
+		if !strings.HasPrefix(method, "/") {
+			errs = append(errs, fmt.Sprintf("%q must start with /", method))
+		}
+		if err := r.compile(); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", method, err))
+			continue
+		}
+		p.Methods[method] = r
+	}
+	if len(errs) > 0 {
+		sort.Strings(errs)
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func (r *Rule) compile() error {
+	r.code = codes.Unavailable
+	if r.Code != "" {
+		//codes.CodeはJSONの文字列として名前を解析できる
+		if err := r.code.UnmarshalJSON([]byte(strconv.Quote(strings.ToUpper(r.Code)))); err != nil {
+			return fmt.Errorf("unknown code %q", r.Code)
+		}
+	}
+	if !(r.Rate >= 0 && r.Rate <= 1) {
+		return fmt.Errorf("rate must be between 0 and 1, got %v", r.Rate)
+	}
+	if r.Attempts < 0 {
+		return fmt.Errorf("attempts must not be negative, got %d", r.Attempts)
+	}
+	var err error
+	if r.delay, err = parseDuration(r.Delay); err != nil {
+		return fmt.Errorf("delay: %v", err)
+	}
+	if r.pushback, err = parseDuration(r.Pushback); err != nil {
+		return fmt.Errorf("pushback: %v", err)
+	}
+	r.hasPushback = r.Pushback != ""
+	return nil
+}
+
+// 空なら0 負の値はエラーにする
+func parseDuration(v string) (time.Duration, error) {
+	if v == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, err
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("must not be negative, got %v", d)
+	}
+	return d, nil
+}
+
+// fullMethodに注入する障害 ルールがなければnil
+// 完全に一致するものを優先し、無ければサービス全体のルールを使う
+func (p *Policy) Rule(fullMethod string) *Rule {
+	if r, ok := p.Methods[fullMethod]; ok {
+		return &r
+	}
+	if i := strings.LastIndex(fullMethod, "/"); i > 0 {
+		if r, ok := p.Methods[fullMethod[:i+1]]; ok {
+			return &r
+		}
+	}
+	return nil
+}
+
+// fullMethodの呼び出しが障害の対象ならDelayだけ待ってからエラーを返す
+// 対象でない場合と、CodeがOKの場合は待った後にnilを返す
+// ctxが終わるとその理由のステータスを返す
+func (p *Policy) Inject(ctx context.Context, fullMethod string) error {
+	r := p.Rule(fullMethod)
+	if r == nil {
+		return nil
+	}
+	attempt := previousAttempts(ctx)
+	if attempt >= r.Attempts && !(r.Rate > 0 && rand.Float64() < r.Rate) {
+		return nil
+	}
+
+	if r.delay > 0 {
+		t := time.NewTimer(r.delay)
+		defer t.Stop()
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		}
+	}
+	if r.code == codes.OK {
+		return nil
+	}
+
+	msg := r.Message
+	if msg == "" {
+		msg = "injected fault"
+	}
+	details := []proto.Message{rpcerr.Info(rpcerr.ReasonFaultInjected, map[string]string{"attempt": strconv.Itoa(attempt)})}
+	if r.hasPushback {
+		details = append(details, rpcerr.Retry(r.pushback))
+	}
+	return rpcerr.New(r.code, msg, details...)
+}
+
+// リクエストのメタデータにあるそれまでの試行回数 最初の試行なら0
+func previousAttempts(ctx context.Context) int {
+	md, _ := metadata.FromIncomingContext(ctx)
+	v := md.Get(retry.PreviousAttemptsKey)
+	if len(v) == 0 {
+		return 0
+	}
+	n, err := strconv.Atoi(v[0])
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
+}
@@ -0,0 +1,172 @@
+package greeter_test
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"testing"
+	"time"
+
+	"grpctutorial/pkg/greeter"
+	"grpctutorial/pkg/greeting"
+	hellopb "grpctutorial/pkg/grpc"
+	"grpctutorial/pkg/rpcerr"
+	Interceptors "grpctutorial/pkg/server/Interceptor"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// HelloBiStreamsの終わり方毎に、クライアントとserverのハンドラが返すステータスを確認する
+func TestHelloBiStreamsEnd(t *testing.T) {
+	tests := []struct {
+		name string
+		//0ならデフォルトのまま
+		idleTimeout time.Duration
+		//ストリームでやり取りし、最後にRecvが返したエラーを返す cancelでストリームを切断できる
+		run func(t *testing.T, stream hellopb.GreetingService_HelloBiStreamsClient, cancel context.CancelFunc) error
+
+		wantCode codes.Code
+		//ErrorInfoに含まれるはずの理由
+		wantReason string
+	}{
+		{
+			name: "half-close without requests",
+			run: func(t *testing.T, stream hellopb.GreetingService_HelloBiStreamsClient, _ context.CancelFunc) error {
+				if err := stream.CloseSend(); err != nil {
+					t.Fatal(err)
+				}
+				got, err := recvAll(stream.Recv)
+				if len(got) != 0 {
+					t.Errorf("messages = %q, want none", got)
+				}
+				return err
+			},
+		},
+		{
+			//送信を終えた後も、それまでのリクエストへの応答は届く
+			name: "half-close after requests",
+			run: func(t *testing.T, stream hellopb.GreetingService_HelloBiStreamsClient, _ context.CancelFunc) error {
+				for _, name := range []string{"a", "b"} {
+					if err := stream.Send(&hellopb.HelloRequest{Name: name, Language: "en"}); err != nil {
+						t.Fatal(err)
+					}
+				}
+				if err := stream.CloseSend(); err != nil {
+					t.Fatal(err)
+				}
+				got, err := recvAll(stream.Recv)
+				if len(got) != 2 {
+					t.Errorf("messages = %q, want 2", got)
+				}
+				return err
+			},
+		},
+		{
+			name: "client disconnects",
+			run: func(t *testing.T, stream hellopb.GreetingService_HelloBiStreamsClient, cancel context.CancelFunc) error {
+				if err := stream.Send(&hellopb.HelloRequest{Name: "a"}); err != nil {
+					t.Fatal(err)
+				}
+				if _, err := stream.Recv(); err != nil {
+					t.Fatal(err)
+				}
+				cancel()
+				_, err := recvAll(stream.Recv)
+				return err
+			},
+			wantCode: codes.Canceled,
+		},
+		{
+			//挨拶を作れなかった場合は、それまでの応答を送った後にストリームを閉じる
+			name: "server fails",
+			run: func(t *testing.T, stream hellopb.GreetingService_HelloBiStreamsClient, _ context.CancelFunc) error {
+				for _, name := range []string{"a", failName} {
+					if err := stream.Send(&hellopb.HelloRequest{Name: name}); err != nil {
+						t.Fatal(err)
+					}
+				}
+				got, err := recvAll(stream.Recv)
+				if len(got) != 1 {
+					t.Errorf("messages = %q, want 1", got)
+				}
+				return err
+			},
+			wantCode: codes.Internal,
+		},
+		{
+			name:        "idle timeout",
+			idleTimeout: 100 * time.Millisecond,
+			run: func(t *testing.T, stream hellopb.GreetingService_HelloBiStreamsClient, _ context.CancelFunc) error {
+				_, err := recvAll(stream.Recv)
+				return err
+			},
+			wantCode:   codes.Unavailable,
+			wantReason: rpcerr.ReasonIdleTimeout,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handled := make(chan error, 1)
+			record := func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+				err := handler(srv, ss)
+				handled <- err
+				return err
+			}
+			formatter, err := greeting.Load("", "en")
+			if err != nil {
+				t.Fatal(err)
+			}
+			stream := greeter.DefaultStreamOptions()
+			if tt.idleTimeout > 0 {
+				stream.IdleTimeout = tt.idleTimeout
+			}
+			client := hellopb.NewGreetingServiceClient(dial(t,
+				greeter.WithInterceptors(Interceptors.Chain{{Stream: record}}),
+				greeter.WithFormatter(failingFormatter{formatter}),
+				greeter.WithStream(stream),
+			))
+			//接続を確立してから数え始める
+			if _, err := client.Hello(testContext(t), &hellopb.HelloRequest{Name: "bob"}); err != nil {
+				t.Fatal(err)
+			}
+			before := runtime.NumGoroutine()
+
+			ctx, cancel := context.WithCancel(testContext(t))
+			defer cancel()
+			bidi, err := client.HelloBiStreams(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = tt.run(t, bidi, cancel)
+			checkStatus(t, err, tt.wantCode, "")
+			if tt.wantReason != "" {
+				checkReason(t, err, tt.wantReason)
+			}
+
+			select {
+			case err := <-handled:
+				checkStatus(t, err, tt.wantCode, "")
+			case <-time.After(time.Second):
+				t.Fatal("HelloBiStreams did not return")
+			}
+			cancel()
+			waitGoroutines(t, before)
+		})
+	}
+}
+
+// failingFormatterが挨拶を作れない名前
+const failName = "fail"
+
+// failNameの挨拶だけ失敗するFormatter
+type failingFormatter struct {
+	greeter.Formatter
+}
+
+func (f failingFormatter) Format(locale, kind string, data greeting.Data) (string, error) {
+	if data.Name == failName {
+		return "", errors.New("template failed")
+	}
+	return f.Formatter.Format(locale, kind, data)
+}
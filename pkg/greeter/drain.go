@@ -0,0 +1,69 @@
+package greeter
+
+import (
+	"context"
+	"sync"
+
+	"google.golang.org/grpc"
+)
+
+// 処理中のストリームに終了を知らせる
+type drainer struct {
+	once sync.Once
+	ch   chan struct{}
+}
+
+func newDrainer() *drainer {
+	return &drainer{ch: make(chan struct{})}
+}
+
+// 終了を知らせるとcloseされるチャンネル
+func (d *drainer) Done() <-chan struct{} {
+	return d.ch
+}
+
+// 終了を知らせる 2回目以降の呼び出しは何もしない
+func (d *drainer) Drain() {
+	d.once.Do(func() { close(d.ch) })
+}
+
+// 終了を知らされたらストリームのコンテキストを取り消すインターセプター
+// ヘルスチェックのWatchのように、コンテキストだけを見ているストリームも終了させる
+func (d *drainer) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, cancel := context.WithCancel(ss.Context())
+		defer cancel()
+		go func() {
+			select {
+			case <-d.ch:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+
+		err := handler(srv, &drainServerStream{ServerStream: ss, ctx: ctx})
+		//クライアントが切断したのではなく終了を知らせたことで終わった場合
+		if err != nil && ctx.Err() != nil && ss.Context().Err() == nil && d.drained() {
+			return ErrDraining()
+		}
+		return err
+	}
+}
+
+func (d *drainer) drained() bool {
+	select {
+	case <-d.ch:
+		return true
+	default:
+		return false
+	}
+}
+
+type drainServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *drainServerStream) Context() context.Context {
+	return s.ctx
+}
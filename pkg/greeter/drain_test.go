@@ -0,0 +1,140 @@
+package greeter_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"grpctutorial/pkg/greeter"
+	"grpctutorial/pkg/greeter/greetertest"
+	hellopb "grpctutorial/pkg/grpc"
+	"grpctutorial/pkg/rpcerr"
+	Interceptors "grpctutorial/pkg/server/Interceptor"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// Shutdownで処理中のRPCを待ち、開いているストリームを終わらせ、新しいRPCを断る
+func TestShutdownDrains(t *testing.T) {
+	const (
+		drainPeriod = 200 * time.Millisecond
+		//drainPeriodを過ぎてもまだ処理中になるHelloの処理時間
+		slowDelay = time.Second
+	)
+	chain, err := greetertest.DefaultChain()
+	if err != nil {
+		t.Fatal(err)
+	}
+	//名前がslowのHelloを遅らせる
+	slow := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if r, ok := req.(*hellopb.HelloRequest); ok && r.GetName() == "slow" {
+			time.Sleep(slowDelay)
+		}
+		return handler(ctx, req)
+	}
+	chain = append(chain, Interceptors.Interceptor{Unary: slow})
+	h, err := greetertest.Start(greeter.WithInterceptors(chain), greeter.WithDrainPeriod(drainPeriod))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(h.Close)
+	conn, err := h.Dial(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	client := hellopb.NewGreetingServiceClient(conn)
+	ctx := testContext(t)
+
+	//開いたままのストリーム
+	stream, err := client.HelloBiStreams(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := stream.Send(&hellopb.HelloRequest{Name: "bob"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stream.Recv(); err != nil {
+		t.Fatal(err)
+	}
+
+	//処理中のHello
+	inFlight := make(chan error, 1)
+	go func() {
+		_, err := client.Hello(ctx, &hellopb.HelloRequest{Name: "slow"})
+		inFlight <- err
+	}()
+	//Helloがserverに届いてからShutdownを始める
+	time.Sleep(50 * time.Millisecond)
+
+	start := time.Now()
+	shutdown := make(chan error, 1)
+	go func() { shutdown <- h.Server.Shutdown(ctx) }()
+
+	t.Run("health reports NOT_SERVING during the drain period", func(t *testing.T) {
+		time.Sleep(drainPeriod / 4)
+		res, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{Service: "mygrpc"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.GetStatus() != healthpb.HealthCheckResponse_NOT_SERVING {
+			t.Errorf("mygrpc is %s, want %s", res.GetStatus(), healthpb.HealthCheckResponse_NOT_SERVING)
+		}
+	})
+
+	t.Run("open streams get Unavailable after the drain period", func(t *testing.T) {
+		_, err := recvAll(stream.Recv)
+		elapsed := time.Since(start)
+		checkStatus(t, err, codes.Unavailable, "")
+		checkReason(t, err, rpcerr.ReasonShuttingDown)
+		if elapsed < drainPeriod {
+			t.Errorf("stream closed after %v, want after the drain period %v", elapsed, drainPeriod)
+		}
+	})
+
+	t.Run("new RPCs are refused", func(t *testing.T) {
+		//ストリームにはGracefulStopより前に終了を知らせるので、断られるようになるまで少し待つ
+		deadline := time.Now().Add(slowDelay / 2)
+		for {
+			cctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+			_, err := client.Hello(cctx, &hellopb.HelloRequest{Name: "bob"})
+			cancel()
+			if status.Code(err) == codes.Unavailable {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("status = %s (%v), want %s", status.Code(err), err, codes.Unavailable)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		select {
+		case err := <-inFlight:
+			t.Fatalf("in-flight Hello returned before new RPCs were refused: %v", err)
+		default:
+		}
+	})
+
+	t.Run("in-flight unary calls finish", func(t *testing.T) {
+		if err := <-inFlight; err != nil {
+			t.Fatal(err)
+		}
+		if err := <-shutdown; err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+// エラーがreasonのErrorInfoを含むか確認する
+func checkReason(t *testing.T, err error, reason string) {
+	t.Helper()
+	for _, d := range status.Convert(err).Details() {
+		if info, ok := d.(*errdetails.ErrorInfo); ok && info.GetReason() == reason {
+			return
+		}
+	}
+	t.Errorf("no ErrorInfo with reason %s in %v", reason, status.Convert(err).Details())
+}
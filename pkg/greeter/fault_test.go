@@ -0,0 +1,150 @@
+package greeter_test
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	clientInterceptors "grpctutorial/pkg/client/Interceptor"
+	"grpctutorial/pkg/fault"
+	"grpctutorial/pkg/greeter"
+	"grpctutorial/pkg/greeter/greetertest"
+	"grpctutorial/pkg/greeterclient"
+	"grpctutorial/pkg/retry"
+	Interceptors "grpctutorial/pkg/server/Interceptor"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// テストで使うリトライの設定
+var testRetry = greeterclient.RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: 10 * time.Millisecond,
+	MaxBackoff:     50 * time.Millisecond,
+}
+
+// 障害を注入したserverに対して、クライアントのリトライとヘッジングを確認する
+func TestFaultRetry(t *testing.T) {
+	hedging := clientInterceptors.HedgingPolicy{MaxAttempts: 2, Delay: 50 * time.Millisecond}
+	tests := []struct {
+		name string
+		rule fault.Rule
+		opts []greeterclient.Option
+		//期待するステータスコードと試行回数
+		wantCode     codes.Code
+		wantAttempts int64
+		//応答までにかかる時間の範囲 0なら確認しない
+		minElapsed time.Duration
+		maxElapsed time.Duration
+	}{
+		{
+			//最初の2回の試行を失敗させる
+			name:         "Hello is retried until the injected faults stop",
+			rule:         fault.Rule{Attempts: 2},
+			opts:         []greeterclient.Option{greeterclient.WithRetry(testRetry)},
+			wantCode:     codes.OK,
+			wantAttempts: 3,
+		},
+		{
+			name:         "Hello fails when the retry attempts run out",
+			rule:         fault.Rule{Attempts: 5},
+			opts:         []greeterclient.Option{greeterclient.WithRetry(testRetry)},
+			wantCode:     codes.Unavailable,
+			wantAttempts: 3,
+		},
+		{
+			name:         "Hello is not retried for non-retryable codes",
+			rule:         fault.Rule{Code: "INTERNAL", Attempts: 5},
+			opts:         []greeterclient.Option{greeterclient.WithRetry(testRetry)},
+			wantCode:     codes.Internal,
+			wantAttempts: 1,
+		},
+		{
+			//バックオフは50ms以下なので、pushbackに従っていなければすぐにやり直す
+			name:         "retries wait for grpc-retry-pushback-ms",
+			rule:         fault.Rule{Attempts: 1, Pushback: "300ms"},
+			opts:         []greeterclient.Option{greeterclient.WithRetry(testRetry)},
+			wantCode:     codes.OK,
+			wantAttempts: 2,
+			minElapsed:   300 * time.Millisecond,
+		},
+		{
+			//最初の試行だけ遅らせる
+			name:         "hedged Hello returns the fastest response",
+			rule:         fault.Rule{Code: "OK", Attempts: 1, Delay: "3s"},
+			opts:         []greeterclient.Option{greeterclient.WithHedging(hedging)},
+			wantCode:     codes.OK,
+			wantAttempts: 2,
+			maxElapsed:   time.Second,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, attempts := startFault(t, tt.rule, tt.opts...)
+			start := time.Now()
+			_, err := c.Hello(context.Background(), "bob")
+			elapsed := time.Since(start)
+			if got := status.Code(err); got != tt.wantCode {
+				t.Fatalf("status = %s (%v), want %s", got, err, tt.wantCode)
+			}
+			if elapsed < tt.minElapsed || (tt.maxElapsed > 0 && elapsed > tt.maxElapsed) {
+				t.Errorf("call took %v, want between %v and %v", elapsed, tt.minElapsed, tt.maxElapsed)
+			}
+			if got := attempts(); got != tt.wantAttempts {
+				t.Errorf("server received %d attempts, want %d", got, tt.wantAttempts)
+			}
+		})
+	}
+}
+
+// RetryInfoを付けた障害はgrpc-retry-pushback-msのトレイラーでも待ち時間を返す
+func TestFaultPushbackTrailer(t *testing.T) {
+	c, _ := startFault(t, fault.Rule{Attempts: 1, Pushback: "20ms"})
+	var trailer metadata.MD
+	_, err := c.Hello(context.Background(), "bob", grpc.Trailer(&trailer))
+	if status.Code(err) != codes.Unavailable {
+		t.Fatalf("status = %s (%v), want %s", status.Code(err), err, codes.Unavailable)
+	}
+	if got := trailer.Get(retry.PushbackKey); len(got) != 1 || got[0] != "20" {
+		t.Errorf("trailer %s = %v, want [20]", retry.PushbackKey, got)
+	}
+}
+
+// Helloにruleの障害を注入するserverを起動し、optsで接続したクライアントを返す
+// attemptsはserverが受け取ったHelloの数を返す
+func startFault(t *testing.T, rule fault.Rule, opts ...greeterclient.Option) (c *greeterclient.Client, attempts func() int64) {
+	t.Helper()
+	policy := &fault.Policy{Methods: map[string]fault.Rule{"/myapp.GreetingService/Hello": rule}}
+	if err := policy.Compile(); err != nil {
+		t.Fatal(err)
+	}
+	var count atomic.Int64
+	counter := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		count.Add(1)
+		return handler(ctx, req)
+	}
+	//loggingはエラーをトレイラーだけで返すことも確認するために入れる
+	chain := Interceptors.Chain{
+		{Unary: counter},
+		{Unary: Interceptors.LoggingUnaryServerInterceptor(slog.New(slog.NewTextHandler(io.Discard, nil)))},
+		{Unary: Interceptors.FaultUnaryServerInterceptor(policy)},
+	}
+	h, err := greetertest.Start(greeter.WithInterceptors(chain))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(h.Close)
+
+	c, err = greeterclient.Dial(context.Background(), greetertest.Target, append(opts, greeterclient.WithDialOptions(h.DialOptions()...))...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c, count.Load
+}
@@ -0,0 +1,500 @@
+package greeter_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"grpctutorial/pkg/greeter"
+	"grpctutorial/pkg/greeter/greetertest"
+	hellopb "grpctutorial/pkg/grpc"
+	"grpctutorial/pkg/reflectclient"
+	Interceptors "grpctutorial/pkg/server/Interceptor"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// 1つのテストにかける時間の上限
+const testTimeout = 5 * time.Second
+
+// greetertest.DefaultChainのインターセプターで動くserverを起動して接続する
+func dial(t *testing.T, opts ...greeter.Option) *grpc.ClientConn {
+	t.Helper()
+	h, err := greetertest.Start(opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(h.Close)
+	conn, err := h.Dial(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// testTimeoutで終わるコンテキスト
+func testContext(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+func TestHello(t *testing.T) {
+	client := hellopb.NewGreetingServiceClient(dial(t))
+	tests := []struct {
+		name string
+		req  *hellopb.HelloRequest
+		//リクエストに付けるメタデータ
+		md metadata.MD
+
+		want       string
+		wantHeader map[string]string
+		wantCode   codes.Code
+		//BadRequestに含まれるはずのフィールド
+		wantField string
+	}{
+		{
+			name:       "returns a greeting with header and trailer",
+			req:        &hellopb.HelloRequest{Name: "bob"},
+			want:       "hello bob",
+			wantHeader: map[string]string{"type": "unary", "from": "server", "in": "header", "content-language": "en"},
+		},
+		{
+			name:       "greets in the requested language",
+			req:        &hellopb.HelloRequest{Name: "太郎", Language: "ja-JP"},
+			want:       "こんにちは 太郎",
+			wantHeader: map[string]string{"content-language": "ja"},
+		},
+		{
+			name:       "negotiates accept-language",
+			req:        &hellopb.HelloRequest{Name: "bob"},
+			md:         metadata.Pairs("accept-language", "fr;q=1, ja;q=0.8, en;q=0.5"),
+			want:       "こんにちは bob",
+			wantHeader: map[string]string{"content-language": "ja"},
+		},
+		{
+			name:       "falls back to the default language",
+			req:        &hellopb.HelloRequest{Name: "bob", Language: "fr"},
+			want:       "hello bob",
+			wantHeader: map[string]string{"content-language": "en"},
+		},
+		{
+			name:      "rejects an empty name",
+			req:       &hellopb.HelloRequest{},
+			wantCode:  codes.InvalidArgument,
+			wantField: "name",
+		},
+		{
+			name:      "rejects a name that is too long",
+			req:       &hellopb.HelloRequest{Name: strings.Repeat("a", 65)},
+			wantCode:  codes.InvalidArgument,
+			wantField: "name",
+		},
+		{
+			name:      "rejects control characters",
+			req:       &hellopb.HelloRequest{Name: "a\x01b"},
+			wantCode:  codes.InvalidArgument,
+			wantField: "name",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := testContext(t)
+			if tt.md != nil {
+				ctx = metadata.NewOutgoingContext(ctx, tt.md)
+			}
+			var header, trailer metadata.MD
+			res, err := client.Hello(ctx, tt.req, grpc.Header(&header), grpc.Trailer(&trailer))
+			if tt.wantCode != codes.OK {
+				checkStatus(t, err, tt.wantCode, tt.wantField)
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.GetMessage() != tt.want {
+				t.Errorf("message = %q, want %q", res.GetMessage(), tt.want)
+			}
+			checkMD(t, "header", header, tt.wantHeader)
+			if tt.wantHeader["in"] != "" {
+				checkMD(t, "trailer", trailer, map[string]string{"type": "unary", "from": "server", "in": "trailer"})
+			}
+		})
+	}
+}
+
+// validationインターセプターが無くても、名前はハンドラで確認する
+func TestHelloWithoutValidation(t *testing.T) {
+	client := hellopb.NewGreetingServiceClient(dial(t, greeter.WithInterceptors(nil)))
+	for _, name := range []string{"", strings.Repeat("a", 65)} {
+		_, err := client.Hello(testContext(t), &hellopb.HelloRequest{Name: name})
+		checkStatus(t, err, codes.InvalidArgument, "name")
+	}
+}
+
+// 名前の長さはvalidationのルールではなくMaxNameLengthで決まる
+func TestHelloMaxNameLength(t *testing.T) {
+	greeting := greeter.DefaultGreetingOptions()
+	greeting.MaxNameLength = 200
+	client := hellopb.NewGreetingServiceClient(dial(t, greeter.WithGreeting(greeting)))
+	if _, err := client.Hello(testContext(t), &hellopb.HelloRequest{Name: strings.Repeat("a", 200)}); err != nil {
+		t.Fatal(err)
+	}
+	_, err := client.Hello(testContext(t), &hellopb.HelloRequest{Name: strings.Repeat("a", 201)})
+	checkStatus(t, err, codes.InvalidArgument, "name")
+}
+
+func TestHelloServerStream(t *testing.T) {
+	client := hellopb.NewGreetingServiceClient(dial(t))
+	tests := []struct {
+		name string
+		opts *hellopb.StreamOptions
+		//期限 0なら指定しない
+		timeout time.Duration
+
+		want      []string
+		wantCode  codes.Code
+		wantField string
+	}{
+		{
+			name: "sends the requested number of messages",
+			opts: &hellopb.StreamOptions{Count: 3, Interval: durationpb.New(10 * time.Millisecond)},
+			want: []string{"[0] Hello, bob!", "[1] Hello, bob!", "[2] Hello, bob!"},
+		},
+		{
+			name:      "rejects a count above the limit",
+			opts:      &hellopb.StreamOptions{Count: 1 << 30},
+			wantCode:  codes.InvalidArgument,
+			wantField: "stream.count",
+		},
+		{
+			name:      "rejects an interval below the limit",
+			opts:      &hellopb.StreamOptions{Interval: durationpb.New(time.Millisecond)},
+			wantCode:  codes.InvalidArgument,
+			wantField: "stream.interval",
+		},
+		{
+			//最初のメッセージはすぐに送られ、次を待つ間に期限を過ぎる
+			name:     "stops at the deadline",
+			opts:     &hellopb.StreamOptions{Count: 5, Interval: durationpb.New(time.Second)},
+			timeout:  100 * time.Millisecond,
+			want:     []string{"[0] Hello, bob!"},
+			wantCode: codes.DeadlineExceeded,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := testContext(t)
+			if tt.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tt.timeout)
+				defer cancel()
+			}
+			stream, err := client.HelloServerStream(ctx, &hellopb.HelloRequest{Name: "bob", Stream: tt.opts})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := recvAll(stream.Recv)
+			checkStatus(t, err, tt.wantCode, tt.wantField)
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("messages = %q, want %q", got, tt.want)
+			}
+			if tt.wantCode == codes.OK {
+				header, err := stream.Header()
+				if err != nil {
+					t.Fatal(err)
+				}
+				checkMD(t, "header", header, map[string]string{"content-language": "en"})
+			}
+		})
+	}
+}
+
+// クライアントが止めたストリームはserverでも終わり、goroutineが残らない
+func TestHelloServerStreamCancel(t *testing.T) {
+	chain, err := greetertest.DefaultChain()
+	if err != nil {
+		t.Fatal(err)
+	}
+	//ハンドラが返したエラーを受け取る
+	handled := make(chan error, 1)
+	record := func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		err := handler(srv, ss)
+		handled <- err
+		return err
+	}
+	chain = append(chain, Interceptors.Interceptor{Stream: record})
+	client := hellopb.NewGreetingServiceClient(dial(t, greeter.WithInterceptors(chain)))
+	//接続を確立してから数え始める
+	if _, err := client.Hello(testContext(t), &hellopb.HelloRequest{Name: "bob"}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		//最初のメッセージを受け取った後にストリームを止める
+		stop     func(ctx context.Context) (context.Context, context.CancelFunc)
+		wantCode codes.Code
+	}{
+		{
+			name: "client cancels",
+			stop: func(ctx context.Context) (context.Context, context.CancelFunc) {
+				ctx, cancel := context.WithCancel(ctx)
+				return ctx, cancel
+			},
+			wantCode: codes.Canceled,
+		},
+		{
+			name: "deadline passes",
+			stop: func(ctx context.Context) (context.Context, context.CancelFunc) {
+				return context.WithTimeout(ctx, 100*time.Millisecond)
+			},
+			wantCode: codes.DeadlineExceeded,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := runtime.NumGoroutine()
+			ctx, stop := tt.stop(testContext(t))
+			stream, err := client.HelloServerStream(ctx, &hellopb.HelloRequest{
+				Name:   "bob",
+				Stream: &hellopb.StreamOptions{Count: 100, Interval: durationpb.New(time.Second)},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := stream.Recv(); err != nil {
+				t.Fatal(err)
+			}
+			//期限の場合は何もせず、次のメッセージを待つ間に期限を過ぎる
+			if tt.wantCode == codes.Canceled {
+				stop()
+			}
+			_, err = recvAll(stream.Recv)
+			checkStatus(t, err, tt.wantCode, "")
+			stop()
+
+			select {
+			case err := <-handled:
+				checkStatus(t, err, tt.wantCode, "")
+			case <-time.After(time.Second):
+				t.Fatal("HelloServerStream did not return after the stream stopped")
+			}
+			waitGoroutines(t, before)
+		})
+	}
+}
+
+func TestHelloClientStream(t *testing.T) {
+	client := hellopb.NewGreetingServiceClient(dial(t))
+	tests := []struct {
+		name  string
+		names []string
+
+		want      string
+		wantCode  codes.Code
+		wantField string
+	}{
+		{
+			name:  "greets all names at once",
+			names: []string{"a", "b", "c"},
+			want:  "こんにちは、aさん、bさん、cさん!",
+		},
+		{
+			name:      "reports which request is invalid",
+			names:     []string{"a", "", "c"},
+			wantCode:  codes.InvalidArgument,
+			wantField: "requests[1].name",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stream, err := client.HelloClientStream(testContext(t))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, name := range tt.names {
+				//serverがストリームを閉じた後のSendはio.EOFになり、理由はCloseAndRecvで分かる
+				if err := stream.Send(&hellopb.HelloRequest{Name: name, Language: "ja"}); err != nil {
+					break
+				}
+			}
+			res, err := stream.CloseAndRecv()
+			checkStatus(t, err, tt.wantCode, tt.wantField)
+			if tt.wantCode != codes.OK {
+				return
+			}
+			if res.GetMessage() != tt.want {
+				t.Errorf("message = %q, want %q", res.GetMessage(), tt.want)
+			}
+			header, err := stream.Header()
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkMD(t, "header", header, map[string]string{"content-language": "ja"})
+		})
+	}
+}
+
+func TestHelloBiStreams(t *testing.T) {
+	client := hellopb.NewGreetingServiceClient(dial(t))
+
+	t.Run("answers every request with header and trailer", func(t *testing.T) {
+		ctx := metadata.AppendToOutgoingContext(testContext(t), "accept-language", "ja")
+		stream, err := client.HelloBiStreams(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		//リクエスト毎にlanguageで言語を変えられる
+		reqs := []*hellopb.HelloRequest{{Name: "a"}, {Name: "b", Language: "en"}}
+		want := []string{"こんにちは、aさん!", "Hello, b!"}
+		for i, req := range reqs {
+			if err := stream.Send(req); err != nil {
+				t.Fatal(err)
+			}
+			res, err := stream.Recv()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.GetMessage() != want[i] {
+				t.Errorf("message %d = %q, want %q", i, res.GetMessage(), want[i])
+			}
+		}
+		if err := stream.CloseSend(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := recvAll(stream.Recv); err != nil {
+			t.Fatal(err)
+		}
+		header, err := stream.Header()
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkMD(t, "header", header, map[string]string{"type": "stream", "in": "header", "content-language": "ja"})
+		checkMD(t, "trailer", stream.Trailer(), map[string]string{"type": "stream", "in": "trailer"})
+	})
+
+	t.Run("rejects an invalid request", func(t *testing.T) {
+		stream, err := client.HelloBiStreams(testContext(t))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := stream.Send(&hellopb.HelloRequest{Name: strings.Repeat("x", 65)}); err != nil {
+			t.Fatal(err)
+		}
+		_, err = recvAll(stream.Recv)
+		checkStatus(t, err, codes.InvalidArgument, "name")
+	})
+}
+
+func TestHealth(t *testing.T) {
+	client := healthpb.NewHealthClient(dial(t))
+	tests := []struct {
+		name     string
+		service  string
+		want     healthpb.HealthCheckResponse_ServingStatus
+		wantCode codes.Code
+	}{
+		{name: "configured service is serving", service: "mygrpc", want: healthpb.HealthCheckResponse_SERVING},
+		//空白のサービス名はserver全体の状態
+		{name: "server is not serving", service: "", want: healthpb.HealthCheckResponse_NOT_SERVING},
+		{name: "unknown service is not found", service: "unknown", wantCode: codes.NotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := client.Check(testContext(t), &healthpb.HealthCheckRequest{Service: tt.service})
+			checkStatus(t, err, tt.wantCode, "")
+			if err == nil && res.GetStatus() != tt.want {
+				t.Errorf("service %q is %s, want %s", tt.service, res.GetStatus(), tt.want)
+			}
+		})
+	}
+}
+
+func TestReflection(t *testing.T) {
+	services, err := reflectclient.New(dial(t)).ListServices(testContext(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range services {
+		if s == "myapp.GreetingService" {
+			return
+		}
+	}
+	t.Errorf("services = %v, want myapp.GreetingService", services)
+}
+
+// io.EOFかエラーまでメッセージを受信する
+func recvAll(recv func() (*hellopb.HelloResponse, error)) ([]string, error) {
+	var messages []string
+	for {
+		res, err := recv()
+		if errors.Is(err, io.EOF) {
+			return messages, nil
+		}
+		if err != nil {
+			return messages, err
+		}
+		messages = append(messages, res.GetMessage())
+	}
+}
+
+// エラーのステータスコードと、fieldが空でなければBadRequestのフィールドを確認する
+func checkStatus(t *testing.T, err error, code codes.Code, field string) {
+	t.Helper()
+	st := status.Convert(err)
+	if st.Code() != code {
+		t.Fatalf("status = %s (%v), want %s", st.Code(), err, code)
+	}
+	if field == "" {
+		return
+	}
+	for _, d := range st.Details() {
+		if br, ok := d.(*errdetails.BadRequest); ok {
+			for _, v := range br.GetFieldViolations() {
+				if v.GetField() == field {
+					return
+				}
+			}
+		}
+	}
+	t.Errorf("no BadRequest violation for %q in %v", field, st.Details())
+}
+
+// mdにwantのキーと値が全て含まれているか確認する
+func checkMD(t *testing.T, kind string, md metadata.MD, want map[string]string) {
+	t.Helper()
+	for k, v := range want {
+		if got := md.Get(k); len(got) != 1 || got[0] != v {
+			t.Errorf("%s %s = %q, want %q", kind, k, got, v)
+		}
+	}
+}
+
+// goroutineの数がbefore以下に戻るのを待つ
+func waitGoroutines(t *testing.T, before int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		n := runtime.NumGoroutine()
+		if n <= before {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Errorf("%d goroutines are running, want at most %d", n, before)
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
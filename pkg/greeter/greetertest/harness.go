@@ -0,0 +1,93 @@
+package greetertest
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net"
+
+	"grpctutorial/pkg/greeter"
+	Interceptors "grpctutorial/pkg/server/Interceptor"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// bufconnのバッファの大きさ
+const bufSize = 1 << 20
+
+// 同じプロセスの中でネットワークを使わずに動かすgreeter.Server
+type Harness struct {
+	Server *greeter.Server
+
+	lis *bufconn.Listener
+}
+
+// bufconnで待ち受けるgreeter.Serverを作って稼働させる
+// ヘルスチェックのmygrpc、リフレクション、DefaultChainのインターセプターを有効にした設定にoptsを重ねて作る
+// WithInterceptorsを指定するとDefaultChainは使わない
+// ロガーはWithLoggerを指定しなければ何も出力しない
+func Start(opts ...greeter.Option) (*Harness, error) {
+	chain, err := DefaultChain()
+	if err != nil {
+		return nil, err
+	}
+	h := &Harness{lis: bufconn.Listen(bufSize)}
+	all := []greeter.Option{greeter.WithHealth("mygrpc"), greeter.WithReflection(true), greeter.WithInterceptors(chain)}
+	all = append(all, greeter.WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))))
+	all = append(all, opts...)
+	all = append(all, greeter.WithListener(h.lis))
+
+	s, err := greeter.NewServer(all...)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Start(); err != nil {
+		return nil, err
+	}
+	h.Server = s
+	return h, nil
+}
+
+// serverのデフォルトと同じlogging, recovery, validationのインターセプター
+// loggingは何も出力せず、validationはgreeter.DefaultValidationのルールを使う
+func DefaultChain() (Interceptors.Chain, error) {
+	policy := greeter.DefaultValidation()
+	if err := policy.Compile(); err != nil {
+		return nil, err
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	return Interceptors.Chain{
+		{Unary: Interceptors.LoggingUnaryServerInterceptor(logger), Stream: Interceptors.LoggingStreamServerInterceptor(logger)},
+		{Unary: Interceptors.RecoveryUnaryServerInterceptor, Stream: Interceptors.RecoveryStreamServerInterceptor},
+		{Unary: Interceptors.ValidationUnaryServerInterceptor(&policy), Stream: Interceptors.ValidationStreamServerInterceptor(&policy)},
+	}, nil
+}
+
+// DialOptionsで接続する時に指定するアドレス
+const Target = "passthrough:///bufnet"
+
+// serverに接続する
+// 接続はbufconnを通るので、アドレスやTLSの設定は不要
+func (h *Harness) Dial(ctx context.Context, opts ...grpc.DialOption) (*grpc.ClientConn, error) {
+	return grpc.DialContext(ctx, Target, append(h.DialOptions(), opts...)...)
+}
+
+// bufconnを通って接続するためのオプション
+// greeterclient.Dialなどで接続する場合はTargetと一緒に指定する
+func (h *Harness) DialOptions() []grpc.DialOption {
+	return []grpc.DialOption{
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return h.lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	}
+}
+
+// serverを止める 処理中のRPCは待たずに切断する
+func (h *Harness) Close() {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	h.Server.Shutdown(ctx)
+}
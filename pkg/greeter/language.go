@@ -0,0 +1,39 @@
+package greeter
+
+import (
+	"context"
+
+	"grpctutorial/pkg/greeting"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// 言語を決めて挨拶を作る
+// *greeting.Catalogが実装している
+type Formatter interface {
+	//リクエストのlanguageとaccept-languageの値から挨拶に使う言語を決める
+	Negotiate(requested string, acceptLanguage ...string) string
+	//localeの挨拶を作る kindはgreeting.KindHelloなど
+	Format(locale, kind string, data greeting.Data) (string, error)
+}
+
+// 挨拶に使った言語を知らせるヘッダーのキー
+const contentLanguageKey = "content-language"
+
+// リクエストのlanguage、メタデータのaccept-language、serverのデフォルトの順に言語を決める
+func (s *Service) language(ctx context.Context, requested string) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	return s.greetings.Negotiate(requested, md.Get("accept-language")...)
+}
+
+// localeの挨拶を作る
+// テンプレートの誤りはserverの設定の問題なのでcodes.Internalにする
+func (s *Service) greet(locale, kind string, data greeting.Data) (string, error) {
+	message, err := s.greetings.Format(locale, kind, data)
+	if err != nil {
+		return "", status.Errorf(codes.Internal, "greeting template %s/%s: %v", locale, kind, err)
+	}
+	return message, nil
+}
@@ -0,0 +1,74 @@
+package greeter
+
+import (
+	"time"
+
+	"grpctutorial/pkg/validate"
+)
+
+// 挨拶するリクエストの設定
+type GreetingOptions struct {
+	//リクエストとaccept-languageのどちらにも一致する言語がない場合に使う言語
+	DefaultLanguage string
+	//"ja.yaml" のように言語タグをファイル名にしたテンプレートを置くディレクトリ
+	//空なら組み込みの挨拶(ja, en)だけを使う WithFormatterを指定した場合は使わない
+	TemplatesDir string
+	//名前の最大文字数
+	MaxNameLength int
+	//HelloClientStreamで1つのストリームに送れる名前の数
+	MaxNamesPerStream int
+}
+
+// HelloServerStreamとHelloBiStreamsの設定
+// Count, Intervalはリクエストで指定されなかった場合に使う
+type StreamOptions struct {
+	//serverが送信する回数
+	Count int
+	//送信間隔
+	Interval time.Duration
+	//リクエストで指定できる送信回数の上限
+	MaxCount int
+	//リクエストで指定できる送信間隔の範囲
+	MinInterval time.Duration
+	MaxInterval time.Duration
+	//1秒あたりの最大送信数 0なら制限なし
+	MaxRate float64
+	//HelloBiStreamsでリクエストを待つ時間 過ぎたらIDLE_TIMEOUTのErrorInfoを付けたUnavailableでストリームを閉じる 0なら無制限
+	IdleTimeout time.Duration
+}
+
+// WithGreetingを指定しない場合の設定
+func DefaultGreetingOptions() GreetingOptions {
+	return GreetingOptions{
+		DefaultLanguage:   "en",
+		MaxNameLength:     64,
+		MaxNamesPerStream: 1000,
+	}
+}
+
+// WithStreamを指定しない場合の設定
+func DefaultStreamOptions() StreamOptions {
+	return StreamOptions{
+		Count:       5,
+		Interval:    time.Second,
+		MaxCount:    10000,
+		MinInterval: 10 * time.Millisecond,
+		MaxInterval: time.Minute,
+		MaxRate:     100,
+		IdleTimeout: 5 * time.Minute,
+	}
+}
+
+// validationインターセプターでGreetingServiceのリクエストに使うデフォルトのルール
+// 名前は制御文字を含まないこと、言語は言語タグに使える文字だけであることを確認する
+// 名前の長さはGreetingOptions.MaxNameLengthでハンドラが確認するのでここでは制限しない
+func DefaultValidation() validate.Policy {
+	return validate.Policy{
+		Methods: map[string]validate.Rules{
+			"/myapp.GreetingService/": {
+				"name":     {Required: true, Charset: "printable"},
+				"language": {MaxLength: 35, Pattern: "[A-Za-z0-9-]+"},
+			},
+		},
+	}
+}
@@ -0,0 +1,283 @@
+package greeter_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"grpctutorial/pkg/auth"
+	"grpctutorial/pkg/greeter"
+	"grpctutorial/pkg/greeter/greetertest"
+	"grpctutorial/pkg/greeterclient"
+	"grpctutorial/pkg/ratelimit"
+	"grpctutorial/pkg/retry"
+	"grpctutorial/pkg/rpcerr"
+	Interceptors "grpctutorial/pkg/server/Interceptor"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// 呼び出し元の名前を渡すメタデータ
+// bufconnでは接続元のアドレスが全て同じなので、authインターセプターの代わりにこの値を認証済みのsubjectにする
+const callerKey = "x-test-caller"
+
+const helloMethod = "/myapp.GreetingService/Hello"
+
+// レート制限とストリーム数の制限を確認する
+// テスト毎にratelimitインターセプターを入れたserverを起動する
+func TestRateLimit(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  ratelimit.Config
+		opts []greeterclient.Option
+		run  func(t *testing.T, c *greeterclient.Client, l *ratelimit.Limiter)
+	}{
+		{
+			name: "Hello is limited per caller with QuotaFailure and RetryInfo",
+			cfg:  ratelimit.Config{Methods: map[string]ratelimit.Rule{helloMethod: {PerCallerRate: 1, PerCallerBurst: 2}}},
+			run: func(t *testing.T, c *greeterclient.Client, _ *ratelimit.Limiter) {
+				hello(t, c, "alice")
+				hello(t, c, "alice")
+				var trailer metadata.MD
+				_, err := c.Hello(as("alice"), "alice", grpc.Trailer(&trailer))
+				checkQuota(t, err, "caller:subject:alice", true)
+				if len(trailer.Get(retry.PushbackKey)) != 1 {
+					t.Errorf("trailer %s is missing: %v", retry.PushbackKey, trailer)
+				}
+				//他の呼び出し元は制限されない
+				hello(t, c, "bob")
+			},
+		},
+		{
+			name: "Hello is limited per method across callers",
+			cfg:  ratelimit.Config{Methods: map[string]ratelimit.Rule{helloMethod: {Rate: 1, Burst: 1}}},
+			run: func(t *testing.T, c *greeterclient.Client, _ *ratelimit.Limiter) {
+				hello(t, c, "alice")
+				_, err := c.Hello(as("bob"), "bob")
+				checkQuota(t, err, "method:"+helloMethod, true)
+			},
+		},
+		{
+			//1つ目の呼び出しでトークンを使い切り、2つ目は200ms後に補充されるのを待ってリトライで成功する
+			name: "retries wait for the rate limit pushback",
+			cfg:  ratelimit.Config{Methods: map[string]ratelimit.Rule{helloMethod: {PerCallerRate: 5, PerCallerBurst: 1}}},
+			opts: []greeterclient.Option{greeterclient.WithRetry(greeterclient.RetryPolicy{
+				MaxAttempts:    testRetry.MaxAttempts,
+				InitialBackoff: testRetry.InitialBackoff,
+				MaxBackoff:     testRetry.MaxBackoff,
+				RetryableCodes: []codes.Code{codes.ResourceExhausted},
+			})},
+			run: func(t *testing.T, c *greeterclient.Client, _ *ratelimit.Limiter) {
+				hello(t, c, "alice")
+				start := time.Now()
+				hello(t, c, "alice")
+				if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+					t.Errorf("retried after %v, want to wait for the next token", elapsed)
+				}
+			},
+		},
+		{
+			name: "updated limits apply to the next call",
+			cfg:  ratelimit.Config{Methods: map[string]ratelimit.Rule{helloMethod: {PerCallerRate: 0.1, PerCallerBurst: 1}}},
+			run: func(t *testing.T, c *greeterclient.Client, l *ratelimit.Limiter) {
+				hello(t, c, "alice")
+				if _, err := c.Hello(as("alice"), "alice"); status.Code(err) != codes.ResourceExhausted {
+					t.Fatalf("status = %s (%v), want %s", status.Code(err), err, codes.ResourceExhausted)
+				}
+				if err := l.Update(ratelimit.Config{}); err != nil {
+					t.Fatal(err)
+				}
+				hello(t, c, "alice")
+			},
+		},
+		{
+			name: "concurrent streams are capped per caller",
+			cfg:  ratelimit.Config{Methods: map[string]ratelimit.Rule{"/myapp.GreetingService/": {}}, MaxStreamsPerCaller: 1},
+			run: func(t *testing.T, c *greeterclient.Client, _ *ratelimit.Limiter) {
+				//1つ目のストリームを開いたままにする
+				first, err := c.HelloBiStreams(as("alice"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := first.Send("alice"); err != nil {
+					t.Fatal(err)
+				}
+				<-first.Greetings()
+
+				checkQuota(t, biStream(t, c, "alice"), "caller:subject:alice", false)
+				//他の呼び出し元は開ける
+				if err := biStream(t, c, "bob"); err != nil {
+					t.Fatal(err)
+				}
+
+				//1つ目を閉じると開けるようになる
+				first.CloseSend()
+				for range first.Greetings() {
+				}
+				if err := first.Err(); err != nil {
+					t.Fatal(err)
+				}
+				if err := biStream(t, c, "alice"); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		{
+			//上限で断ったストリームはトークンを使わないので、1つ目を閉じればもう1つ開ける
+			name: "streams over the cap do not use a token",
+			cfg: ratelimit.Config{
+				Methods:             map[string]ratelimit.Rule{"/myapp.GreetingService/HelloBiStreams": {PerCallerRate: 0.1, PerCallerBurst: 2}},
+				MaxStreamsPerCaller: 1,
+			},
+			run: func(t *testing.T, c *greeterclient.Client, _ *ratelimit.Limiter) {
+				first, err := c.HelloBiStreams(as("alice"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := first.Send("alice"); err != nil {
+					t.Fatal(err)
+				}
+				<-first.Greetings()
+				for i := 0; i < 3; i++ {
+					checkQuota(t, biStream(t, c, "alice"), "caller:subject:alice", false)
+				}
+
+				first.CloseSend()
+				for range first.Greetings() {
+				}
+				if err := biStream(t, c, "alice"); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		{
+			//ヘルスチェックのWatchはmethodsに一致しないので数えない
+			name: "streams of methods without a rule are not counted",
+			cfg:  ratelimit.Config{Methods: map[string]ratelimit.Rule{"/myapp.GreetingService/": {}}, MaxStreamsPerCaller: 1},
+			run: func(t *testing.T, c *greeterclient.Client, _ *ratelimit.Limiter) {
+				ctx, cancel := context.WithCancel(as("alice"))
+				defer cancel()
+				watch, err := healthpb.NewHealthClient(c.Conn()).Watch(ctx, &healthpb.HealthCheckRequest{Service: "mygrpc"})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err := watch.Recv(); err != nil {
+					t.Fatal(err)
+				}
+				if err := biStream(t, c, "alice"); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, err := ratelimit.New(tt.cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			chain := Interceptors.Chain{
+				{Unary: callerUnaryInterceptor, Stream: callerStreamInterceptor},
+				{Unary: Interceptors.RateLimitUnaryServerInterceptor(l), Stream: Interceptors.RateLimitStreamServerInterceptor(l)},
+			}
+			h, err := greetertest.Start(greeter.WithInterceptors(chain))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer h.Close()
+			c, err := greeterclient.Dial(context.Background(), greetertest.Target, append(tt.opts, greeterclient.WithDialOptions(h.DialOptions()...))...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer c.Close()
+			tt.run(t, c, l)
+		})
+	}
+}
+
+// nameを呼び出し元にしてHelloを呼び、成功しなければテストを終える
+func hello(t *testing.T, c *greeterclient.Client, name string) {
+	t.Helper()
+	if _, err := c.Hello(as(name), name); err != nil {
+		t.Fatalf("Hello as %s: %v", name, err)
+	}
+}
+
+// nameを呼び出し元にしてHelloBiStreamsを開き、何も送らずに閉じた結果を返す
+func biStream(t *testing.T, c *greeterclient.Client, name string) error {
+	t.Helper()
+	s, err := c.HelloBiStreams(as(name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.CloseSend()
+	for range s.Greetings() {
+	}
+	return s.Err()
+}
+
+// nameを呼び出し元にするコンテキスト
+func as(name string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), callerKey, name)
+}
+
+// x-test-callerを認証済みのsubjectとしてコンテキストに格納する
+func withCaller(ctx context.Context) context.Context {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if v := md.Get(callerKey); len(v) > 0 {
+		return auth.NewContext(ctx, &auth.Identity{Subject: v[0]})
+	}
+	return ctx
+}
+
+func callerUnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	return handler(withCaller(ctx), req)
+}
+
+func callerStreamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	return handler(srv, &callerServerStream{ServerStream: ss, ctx: withCaller(ss.Context())})
+}
+
+type callerServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *callerServerStream) Context() context.Context {
+	return s.ctx
+}
+
+// ResourceExhaustedで、subjectのQuotaFailureの違反を含むか確認する
+// ストリーム数の制限はいつ空くか分からないのでRetryInfoを付けない wantRetryでその有無を確認する
+func checkQuota(t *testing.T, err error, subject string, wantRetry bool) {
+	t.Helper()
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("status = %s (%v), want %s", status.Code(err), err, codes.ResourceExhausted)
+	}
+	var found, retry bool
+	for _, d := range status.Convert(err).Details() {
+		switch d := d.(type) {
+		case *errdetails.QuotaFailure:
+			for _, v := range d.GetViolations() {
+				found = found || v.GetSubject() == subject
+			}
+		case *errdetails.ErrorInfo:
+			if d.GetReason() != rpcerr.ReasonRateLimited && d.GetReason() != rpcerr.ReasonTooManyStreams {
+				t.Errorf("unexpected reason %s", d.GetReason())
+			}
+		case *errdetails.RetryInfo:
+			retry = d.GetRetryDelay().AsDuration() > 0
+		}
+	}
+	if !found {
+		t.Errorf("no QuotaFailure violation for %q in %v", subject, status.Convert(err).Details())
+	}
+	if retry != wantRetry {
+		t.Errorf("RetryInfo present = %t, want %t in %v", retry, wantRetry, status.Convert(err).Details())
+	}
+}
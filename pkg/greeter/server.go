@@ -0,0 +1,251 @@
+package greeter
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"time"
+
+	"grpctutorial/pkg/greeting"
+	hellopb "grpctutorial/pkg/grpc"
+	Interceptors "grpctutorial/pkg/server/Interceptor"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+)
+
+// GreetingServiceを提供するgRPCserver
+// ヘルスチェックは常に登録され、空白のサービス名はNOT_SERVINGになる
+type Server struct {
+	grpc   *grpc.Server
+	health *health.Server
+	lis    net.Listener
+	served chan struct{}
+	//Startを呼んだか
+	started bool
+
+	drainer *drainer
+	logger  *slog.Logger
+
+	//Optionで変更する設定
+	address        string
+	serverOptions  []grpc.ServerOption
+	chain          Interceptors.Chain
+	healthServices []string
+	reflection     bool
+	formatter      Formatter
+	greeting       GreetingOptions
+	stream         StreamOptions
+	drainPeriod    time.Duration
+}
+
+// Serverの設定を変更する
+type Option func(*Server)
+
+// 待ち受けるListener 指定するとWithAddressは使われない
+func WithListener(lis net.Listener) Option {
+	return func(s *Server) { s.lis = lis }
+}
+
+// Listenerを指定しない場合に待ち受けるアドレス デフォルトは ":8080"
+func WithAddress(addr string) Option {
+	return func(s *Server) { s.address = addr }
+}
+
+// 先頭が一番外側になるように並べたインターセプター
+func WithInterceptors(chain Interceptors.Chain) Option {
+	return func(s *Server) { s.chain = chain }
+}
+
+// grpc.NewServerに渡すその他のオプション(grpc.Credsなど)
+func WithServerOptions(opts ...grpc.ServerOption) Option {
+	return func(s *Server) { s.serverOptions = append(s.serverOptions, opts...) }
+}
+
+// ヘルスチェックでSERVINGとして登録するサービス名
+func WithHealth(services ...string) Option {
+	return func(s *Server) { s.healthServices = services }
+}
+
+// serverリフレクションを有効にするか デフォルトは無効
+func WithReflection(enabled bool) Option {
+	return func(s *Server) { s.reflection = enabled }
+}
+
+// 挨拶を作るFormatter デフォルトは組み込みの挨拶で、デフォルトの言語はen
+func WithFormatter(f Formatter) Option {
+	return func(s *Server) { s.formatter = f }
+}
+
+// 挨拶するリクエストの設定 デフォルトはDefaultGreetingOptions
+func WithGreeting(cfg GreetingOptions) Option {
+	return func(s *Server) { s.greeting = cfg }
+}
+
+// HelloServerStreamとHelloBiStreamsの設定 デフォルトはDefaultStreamOptions
+func WithStream(cfg StreamOptions) Option {
+	return func(s *Server) { s.stream = cfg }
+}
+
+// Shutdownでヘルスチェックを全てNOT_SERVINGにしてから、処理中のRPCを終わらせるまで待つ時間
+// ロードバランサーが新しいリクエストを送らなくなるまでの時間を指定する デフォルトは0
+func WithDrainPeriod(d time.Duration) Option {
+	return func(s *Server) { s.drainPeriod = d }
+}
+
+// 起動と終了を記録するロガー デフォルトはslog.Default()
+func WithLogger(logger *slog.Logger) Option {
+	return func(s *Server) { s.logger = logger }
+}
+
+// Serverを作る Startを呼ぶまでリクエストは受け付けない
+func NewServer(opts ...Option) (*Server, error) {
+	s := &Server{
+		address:  ":8080",
+		greeting: DefaultGreetingOptions(),
+		stream:   DefaultStreamOptions(),
+		logger:   slog.Default(),
+		drainer:  newDrainer(),
+		served:   make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.formatter == nil {
+		catalog, err := greeting.Load(s.greeting.TemplatesDir, s.greeting.DefaultLanguage)
+		if err != nil {
+			return nil, err
+		}
+		s.formatter = catalog
+	}
+
+	//エラーのRetryInfoをpushbackのトレイラーにするインターセプターは一番外側に置く
+	serverOptions := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(Interceptors.PushbackUnaryServerInterceptor),
+		grpc.ChainStreamInterceptor(Interceptors.PushbackStreamServerInterceptor),
+	}
+	serverOptions = append(serverOptions, Interceptors.ServerOptions(s.chain)...)
+	serverOptions = append(serverOptions, s.serverOptions...)
+	//終了時に処理中のストリームを終わらせるインターセプターは一番内側に置く
+	serverOptions = append(serverOptions, grpc.ChainStreamInterceptor(s.drainer.StreamServerInterceptor()))
+	s.grpc = grpc.NewServer(serverOptions...)
+
+	//ヘルスチェック
+	s.health = health.NewServer()
+	healthpb.RegisterHealthServer(s.grpc, s.health)
+	//設定されたサービス名で呼ぶことでヘルスステータスを確認できる
+	for _, name := range s.healthServices {
+		s.health.SetServingStatus(name, healthpb.HealthCheckResponse_SERVING)
+	}
+	//空白の場合はエラーにする
+	s.health.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+
+	//gRPCサーバーにGreetingServiceを登録
+	hellopb.RegisterGreetingServiceServer(s.grpc, New(s.greeting, s.formatter, s.stream, s.drainer.Done()))
+
+	//serverリフレクションの設定
+	if s.reflection {
+		reflection.Register(s.grpc)
+	}
+	return s, nil
+}
+
+// 他のサービスを登録するためのgRPCserver
+// Startより前に登録する
+func (s *Server) GRPCServer() *grpc.Server {
+	return s.grpc
+}
+
+// ヘルスチェックのserver
+func (s *Server) Health() *health.Server {
+	return s.health
+}
+
+// 待ち受けているアドレス Startより前はnil
+func (s *Server) Addr() net.Addr {
+	if s.lis == nil {
+		return nil
+	}
+	return s.lis.Addr()
+}
+
+// 待ち受けを始め、別のgoroutineでリクエストを処理する
+func (s *Server) Start() error {
+	if s.started {
+		return errors.New("greeter: server already started")
+	}
+	if s.lis == nil {
+		lis, err := net.Listen("tcp", s.address)
+		if err != nil {
+			return err
+		}
+		s.lis = lis
+	}
+	s.started = true
+	go func() {
+		defer close(s.served)
+		s.logger.Info("start gRPC server", "address", s.lis.Addr().String())
+		if err := s.grpc.Serve(s.lis); err != nil && !errors.Is(err, grpc.ErrServerStopped) {
+			s.logger.Error("gRPC server stopped", "error", err)
+		}
+	}()
+	return nil
+}
+
+// serverを順に止める
+//  1. ヘルスチェックを全てNOT_SERVINGにし、新しいリクエストが来なくなるまでWithDrainPeriodの時間だけ待つ
+//  2. 処理中のストリームに終了を知らせ、GracefulStopでRPCが終わるのを待つ
+//  3. ctxが終わっても終わらなければStopで強制的に切断し、ctx.Err()を返す
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.logger.Info("shutting down: reporting NOT_SERVING", "drain_period", s.drainPeriod.String())
+	//Shutdownは全てのサービスをNOT_SERVINGにし、以降の変更を無視する
+	s.health.Shutdown()
+
+	drain := time.NewTimer(s.drainPeriod)
+	defer drain.Stop()
+	select {
+	case <-drain.C:
+	case <-ctx.Done():
+		s.logger.Warn("shutdown interrupted, stopping immediately", "error", ctx.Err())
+		s.drainer.Drain()
+		s.stop()
+		return ctx.Err()
+	}
+
+	s.logger.Info("shutting down: waiting for in-flight RPCs")
+	s.drainer.Drain()
+	stopped := make(chan struct{})
+	go func() {
+		s.grpc.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		s.wait()
+		s.logger.Info("gRPC server stopped")
+		return nil
+	case <-ctx.Done():
+		s.logger.Warn("in-flight RPCs did not finish in time, closing them", "error", ctx.Err())
+	}
+	s.stop()
+	<-stopped
+	return ctx.Err()
+}
+
+// 全ての接続を切断してserverを止める
+func (s *Server) stop() {
+	s.grpc.Stop()
+	s.wait()
+	s.logger.Info("gRPC server stopped")
+}
+
+// Serveが終わるのを待つ Startしていなければすぐに返る
+func (s *Server) wait() {
+	if s.started {
+		<-s.served
+	}
+}
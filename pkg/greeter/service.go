@@ -0,0 +1,289 @@
+package greeter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+	"unicode/utf8"
+
+	"grpctutorial/pkg/greeting"
+	hellopb "grpctutorial/pkg/grpc"
+	"grpctutorial/pkg/logging"
+	"grpctutorial/pkg/rpcerr"
+	Interceptors "grpctutorial/pkg/server/Interceptor"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// GreetingServiceの実装
+// 他のserverに組み込む場合はNewで作ってRegisterGreetingServiceServerで登録する
+type Service struct {
+	hellopb.UnimplementedGreetingServiceServer
+
+	//名前の制限
+	greeting GreetingOptions
+
+	//言語毎の挨拶
+	greetings Formatter
+
+	//HelloServerStreamの設定
+	stream StreamOptions
+
+	//serverの終了時にcloseされる 処理中のストリームはこれを見て終了する
+	drain <-chan struct{}
+}
+
+// Unary RPCがレスポンスを返すところ
+func (s *Service) Hello(ctx context.Context, req *hellopb.HelloRequest) (*hellopb.HelloResponse, error) {
+	if err := s.checkName("name", req.GetName()); err != nil {
+		return nil, err
+	}
+
+	//ctxからメタデータを取得
+	//値には認証情報が含まれることがあるのでキーだけ記録する
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		logging.FromContext(ctx).Debug("incoming metadata", "keys", metadataKeys(md))
+	}
+
+	//挨拶の言語を決める
+	locale := s.language(ctx, req.GetLanguage())
+	message, err := s.greet(locale, greeting.KindHello, greeting.Data{Name: req.GetName()})
+	if err != nil {
+		return nil, err
+	}
+
+	//ヘッダーを作成
+	headerMD := metadata.New(map[string]string{"type": "unary", "from": "server", "in": "header", contentLanguageKey: locale})
+	if err := grpc.SetHeader(ctx, headerMD); err != nil {
+		return nil, err
+	}
+
+	//トレイラーを作成
+	trailerMD := metadata.New(map[string]string{"type": "unary", "from": "server", "in": "trailer"})
+	if err := grpc.SetTrailer(ctx, trailerMD); err != nil {
+		return nil, err
+	}
+
+	// HelloResponse型を1つreturnする
+	// (Unaryなので、レスポンスを一つ返せば終わり)
+	return &hellopb.HelloResponse{
+		Message: message,
+	}, nil
+}
+
+// Server Stream RPCがレスポンスを返すところ
+// リクエストで送信回数・間隔・最大送信レートを指定できる
+// Sendはクライアントの受信が追いつかないとフロー制御でブロックするので、送信が溜まり続けることはない
+func (s *Service) HelloServerStream(req *hellopb.HelloRequest, stream hellopb.GreetingService_HelloServerStreamServer) error {
+	ctx := stream.Context()
+	if err := s.checkName("name", req.GetName()); err != nil {
+		return err
+	}
+
+	//送信回数と間隔を決める
+	shape, err := newStreamShape(req.GetStream(), s.stream)
+	if err != nil {
+		return err
+	}
+
+	//挨拶の言語は最初のSendと一緒にヘッダーで知らせる
+	locale := s.language(ctx, req.GetLanguage())
+	if err := stream.SetHeader(metadata.Pairs(contentLanguageKey, locale)); err != nil {
+		return err
+	}
+
+	//送信間隔を待つタイマー
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for i := 0; i < shape.count; i++ {
+		//クライアントが切断したり期限を過ぎたりしたらすぐに終了する
+		select {
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		case <-s.drain:
+			return ErrDraining()
+		case <-timer.C:
+		}
+
+		//reqに送信されたデータが入っている
+		message, err := s.greet(locale, greeting.KindServerStream, greeting.Data{Name: req.GetName(), Index: i})
+		if err != nil {
+			return err
+		}
+		// streamのSendメソッドを使っている
+		if err := stream.Send(&hellopb.HelloResponse{
+			Message: message,
+		}); err != nil {
+			return streamError(ctx, err)
+		}
+		//決めた間隔だけ待機
+		timer.Reset(shape.interval)
+	}
+	return nil
+}
+
+// Client Stream RPCがリクエストを受け取るところ
+func (s *Service) HelloClientStream(stream hellopb.GreetingService_HelloClientStreamServer) error {
+	//受信した名前追加
+	nameList := make([]string, 0)
+	//最初にlanguageを指定したリクエストの言語で挨拶する
+	requested := ""
+	for {
+		//streamのRecvメソッドを呼び出してリクエスト内容を取得する
+		req, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			//リクエストを全て受け取ったので纏めて返す!
+			locale := s.language(stream.Context(), requested)
+			message, err := s.greet(locale, greeting.KindClientStream, greeting.Data{Names: nameList})
+			if err != nil {
+				return err
+			}
+			if err := stream.SetHeader(metadata.Pairs(contentLanguageKey, locale)); err != nil {
+				return err
+			}
+			//送信して閉じる
+			return stream.SendAndClose(&hellopb.HelloResponse{
+				Message: message,
+			})
+		}
+		if err != nil {
+			return streamError(stream.Context(), err)
+		}
+		//何番目のリクエストが不正か分かるようにする
+		if err := s.checkName(fmt.Sprintf("requests[%d].name", len(nameList)), req.GetName()); err != nil {
+			return err
+		}
+		//名前は全て溜めてから返すので、数を制限する
+		if len(nameList) >= s.greeting.MaxNamesPerStream {
+			return rpcerr.ResourceExhausted(rpcerr.ReasonQuotaExceeded, 0,
+				rpcerr.Quota("names_per_stream", "at most %d names can be sent in one stream", s.greeting.MaxNamesPerStream))
+		}
+		if requested == "" {
+			requested = req.GetLanguage()
+		}
+		//名前のリストに新しい名前追加
+		nameList = append(nameList, req.GetName())
+	}
+}
+
+func (s *Service) HelloBiStreams(stream hellopb.GreetingService_HelloBiStreamsServer) error {
+	//ストリームのコンテキストからメタデータを取得
+	if md, ok := metadata.FromIncomingContext(stream.Context()); ok {
+		logging.FromContext(stream.Context()).Debug("incoming metadata", "keys", metadataKeys(md))
+	}
+
+	//すぐにヘッダーを送信
+	//リクエストを受け取る前なので、content-languageはaccept-languageから決めた言語になる
+	headerMD := metadata.New(map[string]string{"type": "stream", "from": "server", "in": "header",
+		contentLanguageKey: s.language(stream.Context(), "")})
+	if err := stream.SendHeader(headerMD); err != nil {
+		return streamError(stream.Context(), err)
+	}
+
+	//トレイラー作成
+	trailerMD := metadata.New(map[string]string{"type": "stream", "from": "server", "in": "trailer"})
+	stream.SetTrailer(trailerMD)
+
+	ctx := stream.Context()
+
+	//受信処理
+	//Recvはブロックしてしまうので別のgoroutineで受信し、チャンネルで受け渡す
+	//goroutineのpanicはインターセプターで回復できないのでSafeGoで起動する
+	reqs := make(chan *hellopb.HelloRequest)
+	recvErr := Interceptors.SafeGo(ctx, func() error {
+		for {
+			req, err := stream.Recv()
+			if err != nil {
+				return err
+			}
+			select {
+			case reqs <- req:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	})
+
+	//一定時間リクエストが来なければストリームを閉じる
+	idle := newIdleTimer(s.stream.IdleTimeout)
+	defer idle.Stop()
+
+	//送信処理
+	//ハンドラが返るとストリームのコンテキストが取り消されるので、受信のgoroutineも終了する
+	for {
+		select {
+		case req := <-reqs:
+			idle.Reset()
+			if err := s.checkName("name", req.GetName()); err != nil {
+				return err
+			}
+			//リクエスト毎にlanguageで言語を変えられる
+			message, err := s.greet(s.language(ctx, req.GetLanguage()), greeting.KindBiStream, greeting.Data{Name: req.GetName()})
+			if err != nil {
+				return err
+			}
+			if err := stream.Send(&hellopb.HelloResponse{
+				Message: message,
+			}); err != nil {
+				return streamError(ctx, err)
+			}
+		case err := <-recvErr:
+			//クライアントが送信を終えたら、それまでのリクエストには全て応答済みなので正常に終了する
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return streamError(ctx, err)
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		case <-s.drain:
+			//serverが終了する場合は受信を待たずにストリームを閉じる
+			return ErrDraining()
+		case <-idle.C():
+			//期限はクライアントが決めるものなのでDeadlineExceededは使わず、開き直せることをUnavailableで知らせる
+			return rpcerr.New(codes.Unavailable, fmt.Sprintf("no request received for %v", s.stream.IdleTimeout),
+				rpcerr.Info(rpcerr.ReasonIdleTimeout, map[string]string{"idle_timeout": s.stream.IdleTimeout.String()}))
+		}
+	}
+}
+
+// 名前が空でなく、設定された文字数以内か確認する
+// validationインターセプターを外した場合でも、これだけは必ず確認する
+// 不正な場合はBadRequestを付けたcodes.InvalidArgumentを返す
+func (s *Service) checkName(field, name string) error {
+	if name == "" {
+		return rpcerr.InvalidArgument(rpcerr.Field(field, "must not be empty"))
+	}
+	if n := utf8.RuneCountInString(name); n > s.greeting.MaxNameLength {
+		return rpcerr.InvalidArgument(rpcerr.Field(field, "must be at most %d characters, got %d", s.greeting.MaxNameLength, n))
+	}
+	return nil
+}
+
+// メタデータのキーを並べて返す
+func metadataKeys(md metadata.MD) []string {
+	keys := make([]string, 0, len(md))
+	for k := range md {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// GreetingServiceを作る
+// drainはserverの終了時にcloseするチャンネルで、処理中のストリームはErrDrainingで終了する
+func New(cfg GreetingOptions, greetings Formatter, stream StreamOptions, drain <-chan struct{}) *Service {
+	return &Service{greeting: cfg, greetings: greetings, stream: stream, drain: drain}
+}
+
+// 終了を知らされたストリームが返すエラー
+// クライアントは別のserverに再接続してやり直せる
+func ErrDraining() error {
+	return rpcerr.Unavailable(rpcerr.ReasonShuttingDown, "server is shutting down", time.Second)
+}
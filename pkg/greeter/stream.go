@@ -0,0 +1,124 @@
+package greeter
+
+import (
+	"context"
+	"errors"
+	"math"
+	"time"
+
+	hellopb "grpctutorial/pkg/grpc"
+	"grpctutorial/pkg/rpcerr"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// HelloServerStreamの送信方法
+type streamShape struct {
+	//送信回数
+	count int
+	//次のメッセージを送るまでの待ち時間
+	interval time.Duration
+}
+
+// リクエストとserverの設定から送信方法を決める
+// 設定された範囲外の値はBadRequestを付けたcodes.InvalidArgumentを返す
+func newStreamShape(opts *hellopb.StreamOptions, cfg StreamOptions) (streamShape, error) {
+	shape := streamShape{count: cfg.Count, interval: cfg.Interval}
+
+	if c := opts.GetCount(); c != 0 {
+		if int64(c) > int64(cfg.MaxCount) {
+			return shape, rpcerr.InvalidArgument(rpcerr.Field("stream.count", "must be at most %d, got %d", cfg.MaxCount, c))
+		}
+		shape.count = int(c)
+	}
+
+	if opts.GetInterval() != nil {
+		if err := opts.GetInterval().CheckValid(); err != nil {
+			return shape, rpcerr.InvalidArgument(rpcerr.Field("stream.interval", "%v", err))
+		}
+		interval := opts.GetInterval().AsDuration()
+		if interval < cfg.MinInterval || interval > cfg.MaxInterval {
+			return shape, rpcerr.InvalidArgument(rpcerr.Field("stream.interval", "must be between %v and %v, got %v",
+				cfg.MinInterval, cfg.MaxInterval, interval))
+		}
+		shape.interval = interval
+	}
+
+	rate := opts.GetMaxRate()
+	if !(rate >= 0) || math.IsInf(rate, 0) {
+		return shape, rpcerr.InvalidArgument(rpcerr.Field("stream.max_rate", "must be a finite non-negative number, got %v", rate))
+	}
+	if cfg.MaxRate > 0 && rate > cfg.MaxRate {
+		return shape, rpcerr.InvalidArgument(rpcerr.Field("stream.max_rate", "must be at most %v, got %v", cfg.MaxRate, rate))
+	}
+	//リクエストで指定されなければserverの上限で送る
+	if rate == 0 {
+		rate = cfg.MaxRate
+	}
+	//送信間隔が短すぎる場合は最大送信数を超えないように待ち時間を延ばす
+	if rate > 0 {
+		if min := time.Duration(float64(time.Second) / rate); shape.interval < min {
+			shape.interval = min
+		}
+	}
+	return shape, nil
+}
+
+// ストリームの送受信で起きたエラーをステータスに変換する
+// クライアントの切断や期限切れはCanceledやDeadlineExceededになる
+func streamError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return status.FromContextError(ctx.Err()).Err()
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return status.FromContextError(err).Err()
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	return status.Errorf(codes.Unavailable, "stream broken: %v", err)
+}
+
+// 一定時間何も起きなければ発火するタイマー
+// 時間が0ならC()は発火しない
+type idleTimer struct {
+	timeout time.Duration
+	timer   *time.Timer
+}
+
+func newIdleTimer(timeout time.Duration) *idleTimer {
+	t := &idleTimer{timeout: timeout}
+	if timeout > 0 {
+		t.timer = time.NewTimer(timeout)
+	}
+	return t
+}
+
+// 発火すると時刻が届くチャンネル 無効な場合はnilを返すので発火しない
+func (t *idleTimer) C() <-chan time.Time {
+	if t.timer == nil {
+		return nil
+	}
+	return t.timer.C
+}
+
+// 時間を計り直す
+func (t *idleTimer) Reset() {
+	if t.timer == nil {
+		return
+	}
+	if !t.timer.Stop() {
+		select {
+		case <-t.timer.C:
+		default:
+		}
+	}
+	t.timer.Reset(t.timeout)
+}
+
+func (t *idleTimer) Stop() {
+	if t.timer != nil {
+		t.timer.Stop()
+	}
+}
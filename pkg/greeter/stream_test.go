@@ -0,0 +1,33 @@
+package greeter
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestStreamError(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	tests := []struct {
+		name string
+		ctx  context.Context
+		err  error
+		want codes.Code
+	}{
+		{name: "client canceled", ctx: canceled, err: errors.New("transport closed"), want: codes.Canceled},
+		{name: "context error", ctx: context.Background(), err: context.DeadlineExceeded, want: codes.DeadlineExceeded},
+		{name: "status is kept", ctx: context.Background(), err: status.Error(codes.InvalidArgument, "bad"), want: codes.InvalidArgument},
+		{name: "broken stream", ctx: context.Background(), err: errors.New("connection reset"), want: codes.Unavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := status.Code(streamError(tt.ctx, tt.err)); got != tt.want {
+				t.Errorf("streamError() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,260 @@
+package greeterclient
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	Interceptors "grpctutorial/pkg/client/Interceptor"
+	hellopb "grpctutorial/pkg/grpc"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/keepalive"
+)
+
+// service configで指定するサービス名
+const serviceName = "myapp.GreetingService"
+
+// GreetingServiceのクライアント
+// 標準入力などには依存しないので、bufconnの接続でもそのまま使える
+type Client struct {
+	conn     *grpc.ClientConn
+	rpc      hellopb.GreetingServiceClient
+	language string
+}
+
+// 接続の設定
+type options struct {
+	tlsConfig *tls.Config
+	token     string
+	retry     *RetryPolicy
+	hedging   *Interceptors.HedgingPolicy
+	//WithServiceConfigで指定されたJSON
+	serviceConfig string
+	interceptors  Interceptors.Chain
+	keepalive     *keepalive.ClientParameters
+	language      string
+	dialOptions   []grpc.DialOption
+}
+
+// Clientの設定を変更する
+type Option func(*options)
+
+// TLSで接続する 指定しなければ平文で接続する
+// 設定はcerts.ClientConfigで作れる
+func WithTLS(cfg *tls.Config) Option {
+	return func(o *options) { o.tlsConfig = cfg }
+}
+
+// 全てのリクエストにbearerトークン(APIキーかJWT)を付ける
+func WithToken(token string) Option {
+	return func(o *options) { o.token = token }
+}
+
+// 失敗したRPCをやり直す方法
+type RetryPolicy struct {
+	//最初の呼び出しを含めた最大の試行回数 2以上にする
+	MaxAttempts int
+	//最初にやり直すまでの待ち時間の上限と、待ち時間の最大値
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	//やり直す度に待ち時間の上限を何倍にするか
+	BackoffMultiplier float64
+	//やり直すステータスコード 空ならUNAVAILABLEだけ
+	RetryableCodes []codes.Code
+}
+
+// 失敗したRPCをpolicyに従ってやり直す
+// gRPCのservice configのretryPolicyとしてGreetingServiceの全てのメソッドに設定する
+func WithRetry(policy RetryPolicy) Option {
+	return func(o *options) { o.retry = &policy }
+}
+
+// Helloを時間をずらして並行に送り、最初に成功した応答を使う
+// WithRetryとは同時に指定できない
+func WithHedging(policy Interceptors.HedgingPolicy) Option {
+	return func(o *options) { o.hedging = &policy }
+}
+
+// gRPCのservice configのJSON
+// methodConfigのretryPolicyはgRPCが、hedgingPolicyはヘッジングのインターセプターが使う
+// WithRetryやWithHedgingとは同時に指定できない
+func WithServiceConfig(json string) Option {
+	return func(o *options) { o.serviceConfig = json }
+}
+
+// 先頭が一番外側になるように並べたインターセプター
+func WithInterceptors(chain Interceptors.Chain) Option {
+	return func(o *options) { o.interceptors = chain }
+}
+
+// RPCの処理中に通信がなければintervalの間隔でpingを送り、timeoutまでに応答がなければ切断する
+// serverは5分より短い間隔のpingを既定では拒否するので、serverの設定に合わせる
+func WithKeepalive(interval, timeout time.Duration) Option {
+	return func(o *options) {
+		o.keepalive = &keepalive.ClientParameters{Time: interval, Timeout: timeout}
+	}
+}
+
+// リクエストのlanguageに指定する言語 空ならserverに任せる
+func WithLanguage(language string) Option {
+	return func(o *options) { o.language = language }
+}
+
+// grpc.DialContextに渡すその他のオプション
+func WithDialOptions(opts ...grpc.DialOption) Option {
+	return func(o *options) { o.dialOptions = append(o.dialOptions, opts...) }
+}
+
+// addrのserverに接続する
+// 接続が確立するかctxが終わるまで待つ
+func Dial(ctx context.Context, addr string, opts ...Option) (*Client, error) {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	creds := insecure.NewCredentials()
+	if o.tlsConfig != nil {
+		creds = credentials.NewTLS(o.tlsConfig)
+	}
+	sc, hedging, err := o.policies()
+	if err != nil {
+		return nil, err
+	}
+	chain := o.interceptors
+	//トークンはインターセプターが付けたメタデータより後に付ける
+	if o.token != "" {
+		chain = append(chain, Interceptors.Interceptor{
+			Unary:  Interceptors.TokenUnaryClientInterceptor(o.token),
+			Stream: Interceptors.TokenStreamClientInterceptor(o.token),
+		})
+	}
+	//ヘッジングは試行毎にRPCを呼ぶので一番内側に置く
+	if len(hedging) > 0 {
+		chain = append(chain, Interceptors.Interceptor{Unary: Interceptors.HedgingUnaryClientInterceptor(hedging)})
+	}
+	dialOptions := append(Interceptors.DialOptions(chain), grpc.WithTransportCredentials(creds), grpc.WithBlock())
+	if sc != "" {
+		dialOptions = append(dialOptions, grpc.WithDefaultServiceConfig(sc))
+	}
+	if o.keepalive != nil {
+		dialOptions = append(dialOptions, grpc.WithKeepaliveParams(*o.keepalive))
+	}
+	dialOptions = append(dialOptions, o.dialOptions...)
+
+	conn, err := grpc.DialContext(ctx, addr, dialOptions...)
+	if err != nil {
+		return nil, fmt.Errorf("connection to %s failed: %w", addr, err)
+	}
+	c := New(conn, o.language)
+	c.conn = conn
+	return c, nil
+}
+
+// 接続済みのccを使うClientを作る
+// ccはCloseで閉じない
+func New(cc grpc.ClientConnInterface, language string) *Client {
+	return &Client{rpc: hellopb.NewGreetingServiceClient(cc), language: language}
+}
+
+// Dialで作った接続を閉じる
+func (c *Client) Close() error {
+	if c.conn == nil {
+		return nil
+	}
+	return c.conn.Close()
+}
+
+// Dialで作った接続 ヘルスチェックなど他のサービスを呼ぶのに使う
+// Newで作った場合はnil
+func (c *Client) Conn() *grpc.ClientConn {
+	return c.conn
+}
+
+// 生成されたGreetingServiceClient
+// ヘッダーやトレイラーを受け取りたい場合などに使う
+func (c *Client) RPC() hellopb.GreetingServiceClient {
+	return c.rpc
+}
+
+// nameに挨拶してもらう
+func (c *Client) Hello(ctx context.Context, name string, opts ...grpc.CallOption) (string, error) {
+	res, err := c.rpc.Hello(ctx, c.request(name), opts...)
+	if err != nil {
+		return "", err
+	}
+	return res.GetMessage(), nil
+}
+
+func (c *Client) request(name string) *hellopb.HelloRequest {
+	return &hellopb.HelloRequest{Name: name, Language: c.language}
+}
+
+// service configのJSONとヘッジングの設定
+func (o *options) policies() (string, Interceptors.HedgingPolicies, error) {
+	if o.retry != nil && o.hedging != nil {
+		return "", nil, errors.New("retry and hedging cannot be combined")
+	}
+	if o.serviceConfig != "" && (o.retry != nil || o.hedging != nil) {
+		return "", nil, errors.New("service config cannot be combined with retry or hedging options")
+	}
+	switch {
+	case o.serviceConfig != "":
+		hedging, err := parseHedging(o.serviceConfig)
+		return o.serviceConfig, hedging, err
+	case o.retry != nil:
+		sc, err := o.retry.serviceConfig()
+		return sc, nil, err
+	case o.hedging != nil:
+		if o.hedging.MaxAttempts < 2 {
+			return "", nil, fmt.Errorf("hedging: MaxAttempts must be at least 2, got %d", o.hedging.MaxAttempts)
+		}
+		return "", Interceptors.HedgingPolicies{"/" + serviceName + "/Hello": *o.hedging}, nil
+	}
+	return "", nil, nil
+}
+
+// service configのJSON
+func (p RetryPolicy) serviceConfig() (string, error) {
+	if p.MaxAttempts < 2 {
+		return "", fmt.Errorf("retry: MaxAttempts must be at least 2, got %d", p.MaxAttempts)
+	}
+	if p.InitialBackoff <= 0 || p.MaxBackoff < p.InitialBackoff {
+		return "", fmt.Errorf("retry: invalid backoff %v..%v", p.InitialBackoff, p.MaxBackoff)
+	}
+	multiplier := p.BackoffMultiplier
+	if multiplier == 0 {
+		multiplier = 2
+	}
+	//コードは数値のまま書ける
+	retryable := p.RetryableCodes
+	if len(retryable) == 0 {
+		retryable = []codes.Code{codes.Unavailable}
+	}
+	sc := map[string]interface{}{
+		"methodConfig": []interface{}{map[string]interface{}{
+			"name": []interface{}{map[string]string{"service": serviceName}},
+			"retryPolicy": map[string]interface{}{
+				"maxAttempts":          p.MaxAttempts,
+				"initialBackoff":       seconds(p.InitialBackoff),
+				"maxBackoff":           seconds(p.MaxBackoff),
+				"backoffMultiplier":    multiplier,
+				"retryableStatusCodes": retryable,
+			},
+		}},
+	}
+	b, err := json.Marshal(sc)
+	return string(b), err
+}
+
+// service configの期間の書式 "0.1s"
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("%gs", d.Seconds())
+}
@@ -0,0 +1,66 @@
+package greeterclient
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	Interceptors "grpctutorial/pkg/client/Interceptor"
+
+	"google.golang.org/grpc/codes"
+)
+
+// service configのうちヘッジングに必要な部分
+type serviceConfig struct {
+	MethodConfig []struct {
+		Name []struct {
+			Service string `json:"service"`
+			Method  string `json:"method"`
+		} `json:"name"`
+		RetryPolicy   json.RawMessage `json:"retryPolicy"`
+		HedgingPolicy *struct {
+			MaxAttempts         int          `json:"maxAttempts"`
+			HedgingDelay        string       `json:"hedgingDelay"`
+			NonFatalStatusCodes []codes.Code `json:"nonFatalStatusCodes"`
+		} `json:"hedgingPolicy"`
+	} `json:"methodConfig"`
+}
+
+// service configのhedgingPolicyをFullMethod毎のHedgingPolicyにする
+// retryPolicyと同じmethodConfigには書けない
+func parseHedging(sc string) (Interceptors.HedgingPolicies, error) {
+	var cfg serviceConfig
+	if err := json.Unmarshal([]byte(sc), &cfg); err != nil {
+		return nil, fmt.Errorf("service config: %w", err)
+	}
+	policies := Interceptors.HedgingPolicies{}
+	for i, mc := range cfg.MethodConfig {
+		hp := mc.HedgingPolicy
+		if hp == nil {
+			continue
+		}
+		if len(mc.RetryPolicy) > 0 && string(mc.RetryPolicy) != "null" {
+			return nil, fmt.Errorf("service config: methodConfig[%d]: retryPolicy and hedgingPolicy cannot be combined", i)
+		}
+		if hp.MaxAttempts < 2 {
+			return nil, fmt.Errorf("service config: methodConfig[%d]: hedgingPolicy.maxAttempts must be at least 2, got %d", i, hp.MaxAttempts)
+		}
+		var delay time.Duration
+		if hp.HedgingDelay != "" {
+			d, err := time.ParseDuration(hp.HedgingDelay)
+			if err != nil || d < 0 {
+				return nil, fmt.Errorf("service config: methodConfig[%d]: invalid hedgingDelay %q", i, hp.HedgingDelay)
+			}
+			delay = d
+		}
+		policy := Interceptors.HedgingPolicy{MaxAttempts: hp.MaxAttempts, Delay: delay, NonFatalCodes: hp.NonFatalStatusCodes}
+		for _, name := range mc.Name {
+			if name.Service == "" {
+				return nil, fmt.Errorf("service config: methodConfig[%d]: hedgingPolicy requires a service name", i)
+			}
+			//methodを省略するとサービス全体に一致する
+			policies["/"+name.Service+"/"+name.Method] = policy
+		}
+	}
+	return policies, nil
+}
@@ -0,0 +1,308 @@
+package greeterclient
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	hellopb "grpctutorial/pkg/grpc"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// HelloServerStreamの送信方法 0の項目はserverのデフォルトを使う
+type StreamOptions struct {
+	//送信回数
+	Count uint32
+	//送信間隔
+	Interval time.Duration
+	//1秒あたりの最大送信数
+	MaxRate float64
+}
+
+// リクエストに入れるStreamOptions
+// 何も指定されていなければnilを返してserverのデフォルトに任せる
+func (o StreamOptions) Proto() *hellopb.StreamOptions {
+	if o.Count == 0 && o.Interval == 0 && o.MaxRate == 0 {
+		return nil
+	}
+	opts := &hellopb.StreamOptions{Count: o.Count, MaxRate: o.MaxRate}
+	if o.Interval > 0 {
+		opts.Interval = durationpb.New(o.Interval)
+	}
+	return opts
+}
+
+// HelloServerStreamのレスポンスを1つずつ読むイテレーター
+//
+//	stream, err := c.HelloServerStream(ctx, "bob", greeterclient.StreamOptions{Count: 3})
+//	for stream.Next() {
+//		fmt.Println(stream.Message())
+//	}
+//	if err := stream.Err(); err != nil { ... }
+type GreetingStream struct {
+	stream hellopb.GreetingService_HelloServerStreamClient
+	res    *hellopb.HelloResponse
+	err    error
+}
+
+// nameへの挨拶をserverから続けて受け取る
+func (c *Client) HelloServerStream(ctx context.Context, name string, opts StreamOptions, callOpts ...grpc.CallOption) (*GreetingStream, error) {
+	req := c.request(name)
+	req.Stream = opts.Proto()
+	stream, err := c.rpc.HelloServerStream(ctx, req, callOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return &GreetingStream{stream: stream}, nil
+}
+
+// 次のレスポンスを受信する
+// ストリームが終わるかエラーになるとfalseを返す
+func (s *GreetingStream) Next() bool {
+	if s.err != nil {
+		return false
+	}
+	s.res, s.err = s.stream.Recv()
+	return s.err == nil
+}
+
+// Nextで受信した挨拶
+func (s *GreetingStream) Message() string {
+	return s.res.GetMessage()
+}
+
+// Nextで受信したレスポンス
+func (s *GreetingStream) Response() *hellopb.HelloResponse {
+	return s.res
+}
+
+// ストリームが失敗した理由 正常に終わった場合はnil
+func (s *GreetingStream) Err() error {
+	if errors.Is(s.err, io.EOF) {
+		return nil
+	}
+	return s.err
+}
+
+// serverから受け取ったヘッダー
+func (s *GreetingStream) Header() (metadata.MD, error) {
+	return s.stream.Header()
+}
+
+// serverから受け取ったトレイラー ストリームが終わってから呼ぶ
+func (s *GreetingStream) Trailer() metadata.MD {
+	return s.stream.Trailer()
+}
+
+// 名前を順にHelloClientStreamで送り、size個毎に新しいストリームに切り替える
+// serverの1つのストリームに送れる名前の数を超えないように分けて送れる
+//
+//	b := c.NewBatcher(ctx, 100)
+//	for _, name := range names {
+//		if err := b.Add(name); err != nil { ... }
+//	}
+//	greetings, err := b.Close()
+type Batcher struct {
+	client *Client
+	ctx    context.Context
+	size   int
+
+	stream    hellopb.GreetingService_HelloClientStreamClient
+	n         int
+	greetings []string
+	err       error
+}
+
+// sizeが0以下なら全ての名前を1つのストリームで送る
+func (c *Client) NewBatcher(ctx context.Context, size int) *Batcher {
+	return &Batcher{client: c, ctx: ctx, size: size}
+}
+
+// 名前を送る 前のストリームがsize個に達していれば、閉じて挨拶を受け取ってから新しいストリームで送る
+// 一度エラーになると以降は同じエラーを返す
+func (b *Batcher) Add(name string) error {
+	if b.err != nil {
+		return b.err
+	}
+	if b.stream == nil {
+		b.stream, b.err = b.client.rpc.HelloClientStream(b.ctx)
+		if b.err != nil {
+			return b.err
+		}
+	}
+	if err := b.stream.Send(b.client.request(name)); err != nil {
+		//serverが先にストリームを閉じた場合、理由はCloseAndRecvで分かる
+		if errors.Is(err, io.EOF) {
+			_, err = b.stream.CloseAndRecv()
+		}
+		b.err = err
+		return err
+	}
+	b.n++
+	if b.size > 0 && b.n >= b.size {
+		return b.flush()
+	}
+	return nil
+}
+
+// 送信中のストリームを閉じて挨拶を受け取る
+func (b *Batcher) flush() error {
+	if b.stream == nil {
+		return nil
+	}
+	res, err := b.stream.CloseAndRecv()
+	b.stream, b.n = nil, 0
+	if err != nil {
+		b.err = err
+		return err
+	}
+	b.greetings = append(b.greetings, res.GetMessage())
+	return nil
+}
+
+// 残りの名前を送り終え、ストリーム毎の挨拶を送った順に返す
+// エラーになった場合も、それまでに受け取った挨拶を返す
+func (b *Batcher) Close() ([]string, error) {
+	if b.err == nil {
+		b.flush()
+	}
+	return b.greetings, b.err
+}
+
+// CloseSendの後にSendを呼んだ
+var ErrSendClosed = errors.New("greeterclient: send on closed session")
+
+// HelloBiStreamsで名前を送りながら挨拶を受け取るセッション
+// 挨拶はGreetingsのチャンネルに届き、ストリームが終わるとチャンネルが閉じる
+//
+//	session, err := c.HelloBiStreams(ctx)
+//	go func() {
+//		for _, name := range names {
+//			session.Send(name)
+//		}
+//		session.CloseSend()
+//	}()
+//	for greeting := range session.Greetings() {
+//		fmt.Println(greeting)
+//	}
+//	if err := session.Err(); err != nil { ... }
+type Session struct {
+	client *Client
+	stream hellopb.GreetingService_HelloBiStreamsClient
+
+	names     chan string
+	closed    chan struct{}
+	closeOnce sync.Once
+	greetings chan string
+	done      chan struct{}
+	err       error
+}
+
+// セッションを始める
+// ctxを取り消すとセッションも終わる
+func (c *Client) HelloBiStreams(ctx context.Context, callOpts ...grpc.CallOption) (*Session, error) {
+	stream, err := c.rpc.HelloBiStreams(ctx, callOpts...)
+	if err != nil {
+		return nil, err
+	}
+	s := &Session{
+		client:    c,
+		stream:    stream,
+		names:     make(chan string),
+		closed:    make(chan struct{}),
+		greetings: make(chan string),
+		done:      make(chan struct{}),
+	}
+	go s.sendLoop()
+	go s.recvLoop(ctx)
+	return s, nil
+}
+
+// 名前を送る
+// CloseSendの後はErrSendClosedを、セッションが終わっていればErrの値かio.EOFを返す
+func (s *Session) Send(name string) error {
+	select {
+	case s.names <- name:
+		return nil
+	case <-s.closed:
+		return ErrSendClosed
+	case <-s.done:
+		if s.err != nil {
+			return s.err
+		}
+		return io.EOF
+	}
+}
+
+// 送信を終える serverは残りの挨拶を送ってからストリームを閉じる
+func (s *Session) CloseSend() {
+	s.closeOnce.Do(func() { close(s.closed) })
+}
+
+// 受け取った挨拶 セッションが終わると閉じる
+func (s *Session) Greetings() <-chan string {
+	return s.greetings
+}
+
+// セッションが終わったことを知らせるチャンネル
+func (s *Session) Done() <-chan struct{} {
+	return s.done
+}
+
+// セッションが失敗した理由 Greetingsが閉じてから呼ぶ 正常に終わった場合はnil
+func (s *Session) Err() error {
+	<-s.done
+	return s.err
+}
+
+// serverから受け取ったヘッダー
+func (s *Session) Header() (metadata.MD, error) {
+	return s.stream.Header()
+}
+
+// serverから受け取ったトレイラー セッションが終わってから呼ぶ
+func (s *Session) Trailer() metadata.MD {
+	return s.stream.Trailer()
+}
+
+func (s *Session) sendLoop() {
+	for {
+		select {
+		case <-s.closed:
+			s.stream.CloseSend()
+			return
+		case name := <-s.names:
+			//送信に失敗した理由はRecvで受け取るステータスで分かる
+			if err := s.stream.Send(s.client.request(name)); err != nil {
+				return
+			}
+		case <-s.done:
+			return
+		}
+	}
+}
+
+func (s *Session) recvLoop(ctx context.Context) {
+	defer close(s.done)
+	defer close(s.greetings)
+	for {
+		res, err := s.stream.Recv()
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				s.err = err
+			}
+			return
+		}
+		select {
+		case s.greetings <- res.GetMessage():
+		case <-ctx.Done():
+			s.err = ctx.Err()
+			return
+		}
+	}
+}
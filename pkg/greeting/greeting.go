@@ -0,0 +1,216 @@
+package greeting
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"text/template"
+
+	"golang.org/x/text/language"
+	"gopkg.in/yaml.v3"
+)
+
+// 挨拶の種類 テンプレートファイルのキーになる
+const (
+	KindHello        = "hello"
+	KindServerStream = "server_stream"
+	KindClientStream = "client_stream"
+	KindBiStream     = "bidi_stream"
+)
+
+var kinds = []string{KindHello, KindServerStream, KindClientStream, KindBiStream}
+
+// テンプレートに渡す値
+type Data struct {
+	//挨拶する名前
+	Name string
+	//HelloClientStreamで受け取った名前の一覧
+	Names []string
+	//HelloServerStreamで何番目の送信か
+	Index int
+}
+
+// 組み込みの挨拶 ファイル名が言語タグになる
+//
+//go:embed locales/*.yaml
+var builtin embed.FS
+
+// テンプレートで使える関数
+var funcs = template.FuncMap{"join": strings.Join}
+
+// 言語毎の挨拶のテンプレート
+type Catalog struct {
+	//先頭がデフォルトの言語
+	locales   []string
+	templates map[string]map[string]*template.Template
+	matcher   language.Matcher
+}
+
+// 組み込みの挨拶にdirのテンプレートを重ねたCatalogを作る
+// dirには "ja.yaml" のように言語タグをファイル名にしたYAMLかJSONのファイルを置く
+// 組み込みの言語と同じ名前のファイルは、書かれた種類だけ置き換える
+// dirが空なら組み込みの挨拶だけを使う
+func Load(dir, defaultLocale string) (*Catalog, error) {
+	texts, err := readTexts(builtin, "locales")
+	if err != nil {
+		return nil, err
+	}
+	if dir != "" {
+		extra, err := readTexts(os.DirFS(dir), ".")
+		if err != nil {
+			return nil, err
+		}
+		for locale, t := range extra {
+			if texts[locale] == nil {
+				texts[locale] = make(map[string]string)
+			}
+			for kind, text := range t {
+				texts[locale][kind] = text
+			}
+		}
+	}
+	return New(texts, defaultLocale)
+}
+
+// 言語タグ毎の種類とテンプレートからCatalogを作る
+// デフォルトの言語には全ての種類が必要で、他の言語に足りない種類はデフォルトの言語で補う
+func New(texts map[string]map[string]string, defaultLocale string) (*Catalog, error) {
+	def, err := language.Parse(defaultLocale)
+	if err != nil {
+		return nil, fmt.Errorf("default language %q: %w", defaultLocale, err)
+	}
+	c := &Catalog{templates: make(map[string]map[string]*template.Template)}
+	for name, t := range texts {
+		tag, err := language.Parse(name)
+		if err != nil {
+			return nil, fmt.Errorf("language %q: %w", name, err)
+		}
+		locale := tag.String()
+		c.templates[locale] = make(map[string]*template.Template)
+		for kind, text := range t {
+			if !knownKind(kind) {
+				return nil, fmt.Errorf("%s: unknown greeting %q (%s)", locale, kind, strings.Join(kinds, ", "))
+			}
+			tmpl, err := template.New(locale + "/" + kind).Funcs(funcs).Option("missingkey=error").Parse(text)
+			if err != nil {
+				return nil, err
+			}
+			c.templates[locale][kind] = tmpl
+		}
+		if locale != def.String() {
+			c.locales = append(c.locales, locale)
+		}
+	}
+
+	defaults, ok := c.templates[def.String()]
+	if !ok {
+		return nil, fmt.Errorf("no greetings for the default language %q", def)
+	}
+	for _, kind := range kinds {
+		if defaults[kind] == nil {
+			return nil, fmt.Errorf("%s: greeting %q is required in the default language", def, kind)
+		}
+	}
+
+	//Matcherは先頭の言語を一致しなかった場合に使う
+	sort.Strings(c.locales)
+	c.locales = append([]string{def.String()}, c.locales...)
+	tags := make([]language.Tag, len(c.locales))
+	for i, l := range c.locales {
+		tags[i] = language.MustParse(l)
+	}
+	c.matcher = language.NewMatcher(tags)
+	return c, nil
+}
+
+// fsys/dirにある *.yaml, *.yml, *.json を言語タグ毎に読み込む
+// 言語タグは正規化し、"JA.yaml" も "ja" として扱う
+func readTexts(fsys fs.FS, dir string) (map[string]map[string]string, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	texts := make(map[string]map[string]string)
+	for _, e := range entries {
+		ext := path.Ext(e.Name())
+		if e.IsDir() || (ext != ".yaml" && ext != ".yml" && ext != ".json") {
+			continue
+		}
+		tag, err := language.Parse(strings.TrimSuffix(e.Name(), ext))
+		if err != nil {
+			return nil, fmt.Errorf("%s: file name must be a language tag: %w", e.Name(), err)
+		}
+		data, err := fs.ReadFile(fsys, path.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		t := make(map[string]string)
+		//JSONはYAMLとしても読み込める
+		if err := yaml.Unmarshal(data, &t); err != nil {
+			return nil, fmt.Errorf("%s: %w", e.Name(), err)
+		}
+		texts[tag.String()] = t
+	}
+	return texts, nil
+}
+
+func knownKind(kind string) bool {
+	for _, k := range kinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// 使える言語 先頭がデフォルト
+func (c *Catalog) Locales() []string {
+	return append([]string(nil), c.locales...)
+}
+
+// 挨拶に使う言語を決める
+// requestedに近い言語があればそれを、なければaccept-languageの値から優先度順に探し、
+// どちらも一致しなければデフォルトの言語を返す
+func (c *Catalog) Negotiate(requested string, acceptLanguage ...string) string {
+	if requested != "" {
+		if tag, err := language.Parse(requested); err == nil {
+			if _, i, conf := c.matcher.Match(tag); conf != language.No {
+				return c.locales[i]
+			}
+		}
+	}
+	var tags []language.Tag
+	for _, v := range acceptLanguage {
+		//解析できない値は無視する
+		t, _, _ := language.ParseAcceptLanguage(v)
+		tags = append(tags, t...)
+	}
+	if len(tags) > 0 {
+		if _, i, conf := c.matcher.Match(tags...); conf != language.No {
+			return c.locales[i]
+		}
+	}
+	return c.locales[0]
+}
+
+// localeの挨拶を作る
+// localeに種類がなければデフォルトの言語のテンプレートを使う
+func (c *Catalog) Format(locale, kind string, data Data) (string, error) {
+	tmpl := c.templates[locale][kind]
+	if tmpl == nil {
+		tmpl = c.templates[c.locales[0]][kind]
+	}
+	if tmpl == nil {
+		return "", fmt.Errorf("unknown greeting %q", kind)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
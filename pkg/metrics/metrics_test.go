@@ -0,0 +1,98 @@
+package metrics_test
+
+import (
+	"strings"
+	"testing"
+
+	"grpctutorial/pkg/metrics"
+)
+
+// registryのテキスト出力がwantと一致するか確認する
+func checkText(t *testing.T, r *metrics.Registry, want string) {
+	t.Helper()
+	var b strings.Builder
+	if err := r.WriteText(&b); err != nil {
+		t.Fatal(err)
+	}
+	if got := b.String(); got != want {
+		t.Errorf("WriteText() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestCounterAndGauge(t *testing.T) {
+	r := metrics.NewRegistry()
+	c := r.NewCounterVec("requests_total", "Total requests.", "method", "code")
+	c.Inc("/b", "OK")
+	c.Add(2, "/a", "OK")
+	c.Inc("/a", "OK")
+	g := r.NewGaugeVec("in_flight", "Requests in flight.")
+	g.Add(3)
+	g.Add(-1)
+
+	checkText(t, r, `# HELP requests_total Total requests.
+# TYPE requests_total counter
+requests_total{method="/a",code="OK"} 3
+requests_total{method="/b",code="OK"} 1
+# HELP in_flight Requests in flight.
+# TYPE in_flight gauge
+in_flight 2
+`)
+}
+
+func TestEscaping(t *testing.T) {
+	r := metrics.NewRegistry()
+	c := r.NewCounterVec("errors_total", "Errors by message.\nBackslash: \\.", "message")
+	c.Inc("say \"hi\"\\\nbye")
+
+	checkText(t, r, `# HELP errors_total Errors by message.\nBackslash: \\.
+# TYPE errors_total counter
+errors_total{message="say \"hi\"\\\nbye"} 1
+`)
+}
+
+func TestHistogram(t *testing.T) {
+	r := metrics.NewRegistry()
+	//バケットは並び替えられる
+	h := r.NewHistogramVec("latency_seconds", "Latency.", []float64{1, 0.5}, "method")
+	h.Observe(0.2, "/a")
+	h.Observe(0.5, "/a")
+	h.Observe(0.7, "/a")
+	h.Observe(3, "/a")
+
+	//各バケットには上限以下の値が累積で数えられる
+	checkText(t, r, `# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{method="/a",le="0.5"} 2
+latency_seconds_bucket{method="/a",le="1"} 3
+latency_seconds_bucket{method="/a",le="+Inf"} 4
+latency_seconds_sum{method="/a"} 4.4
+latency_seconds_count{method="/a"} 4
+`)
+}
+
+func TestFuncVec(t *testing.T) {
+	r := metrics.NewRegistry()
+	r.NewGaugeFunc("streams", "Open streams.", []string{"method"}, func() []metrics.Sample {
+		return []metrics.Sample{
+			{LabelValues: []string{"/b"}, Value: 1},
+			{LabelValues: []string{"/a"}, Value: 2},
+		}
+	})
+
+	checkText(t, r, `# HELP streams Open streams.
+# TYPE streams gauge
+streams{method="/a"} 2
+streams{method="/b"} 1
+`)
+}
+
+func TestRegisterTwice(t *testing.T) {
+	r := metrics.NewRegistry()
+	r.NewCounterVec("requests_total", "Total requests.")
+	defer func() {
+		if recover() == nil {
+			t.Error("registering the same name twice did not panic")
+		}
+	}()
+	r.NewGaugeVec("requests_total", "Total requests.")
+}
@@ -0,0 +1,173 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+)
+
+// 増加だけするカウンター
+type CounterVec struct {
+	vec
+	mu     sync.Mutex
+	values map[string]*Sample
+}
+
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{vec: vec{name, help, "counter", labels}, values: make(map[string]*Sample)}
+	r.register(c)
+	return c
+}
+
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+func (c *CounterVec) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		panic("metrics: counter cannot decrease")
+	}
+	add(&c.mu, c.values, c.key(labelValues), labelValues, v)
+}
+
+func (c *CounterVec) write(w *bufio.Writer) {
+	c.header(w)
+	writeSamples(w, &c.vec, &c.mu, c.values)
+}
+
+// 増減するゲージ
+type GaugeVec struct {
+	vec
+	mu     sync.Mutex
+	values map[string]*Sample
+}
+
+func (r *Registry) NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	g := &GaugeVec{vec: vec{name, help, "gauge", labels}, values: make(map[string]*Sample)}
+	r.register(g)
+	return g
+}
+
+func (g *GaugeVec) Set(v float64, labelValues ...string) {
+	key := g.key(labelValues)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.values[key] = &Sample{LabelValues: append([]string(nil), labelValues...), Value: v}
+}
+
+func (g *GaugeVec) Add(v float64, labelValues ...string) {
+	add(&g.mu, g.values, g.key(labelValues), labelValues, v)
+}
+
+func (g *GaugeVec) write(w *bufio.Writer) {
+	g.header(w)
+	writeSamples(w, &g.vec, &g.mu, g.values)
+}
+
+// 出力する時に値を取得するメトリクス
+// typにはgaugeかcounterを指定する
+type FuncVec struct {
+	vec
+	collect func() []Sample
+}
+
+func (r *Registry) NewGaugeFunc(name, help string, labels []string, collect func() []Sample) *FuncVec {
+	f := &FuncVec{vec: vec{name, help, "gauge", labels}, collect: collect}
+	r.register(f)
+	return f
+}
+
+func (r *Registry) NewCounterFunc(name, help string, labels []string, collect func() []Sample) *FuncVec {
+	f := &FuncVec{vec: vec{name, help, "counter", labels}, collect: collect}
+	r.register(f)
+	return f
+}
+
+func (f *FuncVec) write(w *bufio.Writer) {
+	f.header(w)
+	samples := f.collect()
+	sort.Slice(samples, func(i, j int) bool {
+		return f.key(samples[i].LabelValues) < f.key(samples[j].LabelValues)
+	})
+	for _, s := range samples {
+		fmt.Fprintf(w, "%s%s %s\n", f.fqName, formatLabels(f.labels, s.LabelValues), formatValue(s.Value))
+	}
+}
+
+// 値の分布を記録するヒストグラム
+type HistogramVec struct {
+	vec
+	buckets []float64
+	mu      sync.Mutex
+	values  map[string]*histogram
+}
+
+type histogram struct {
+	labelValues []string
+	counts      []uint64
+	sum         float64
+	count       uint64
+}
+
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	h := &HistogramVec{vec: vec{name, help, "histogram", labels}, buckets: buckets, values: make(map[string]*histogram)}
+	r.register(h)
+	return h
+}
+
+func (h *HistogramVec) Observe(v float64, labelValues ...string) {
+	key := h.key(labelValues)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	hist, ok := h.values[key]
+	if !ok {
+		hist = &histogram{labelValues: append([]string(nil), labelValues...), counts: make([]uint64, len(h.buckets))}
+		h.values[key] = hist
+	}
+	for i, upper := range h.buckets {
+		if v <= upper {
+			hist.counts[i]++
+		}
+	}
+	hist.sum += v
+	hist.count++
+}
+
+func (h *HistogramVec) write(w *bufio.Writer) {
+	h.header(w)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, key := range sortedKeys(h.values) {
+		hist := h.values[key]
+		for i, upper := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.fqName, formatLabels(h.labels, hist.labelValues, "le", formatValue(upper)), hist.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.fqName, formatLabels(h.labels, hist.labelValues, "le", formatValue(math.Inf(1))), hist.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.fqName, formatLabels(h.labels, hist.labelValues), formatValue(hist.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.fqName, formatLabels(h.labels, hist.labelValues), hist.count)
+	}
+}
+
+func add(mu *sync.Mutex, values map[string]*Sample, key string, labelValues []string, v float64) {
+	mu.Lock()
+	defer mu.Unlock()
+	s, ok := values[key]
+	if !ok {
+		s = &Sample{LabelValues: append([]string(nil), labelValues...)}
+		values[key] = s
+	}
+	s.Value += v
+}
+
+func writeSamples(w *bufio.Writer, v *vec, mu *sync.Mutex, values map[string]*Sample) {
+	mu.Lock()
+	defer mu.Unlock()
+	for _, key := range sortedKeys(values) {
+		s := values[key]
+		fmt.Fprintf(w, "%s%s %s\n", v.fqName, formatLabels(v.labels, s.LabelValues), formatValue(s.Value))
+	}
+}
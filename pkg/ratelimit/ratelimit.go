@@ -0,0 +1,263 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"grpctutorial/pkg/auth"
+	"grpctutorial/pkg/rpcerr"
+
+	"google.golang.org/grpc/peer"
+)
+
+// 1つのFullMethodの制限
+// 値が0の制限は適用しない
+type Rule struct {
+	//メソッド全体で1秒あたりに受け付ける呼び出しの数と、連続して受け付けられる数
+	Rate  float64 `yaml:"rate" json:"rate"`
+	Burst int     `yaml:"burst" json:"burst"`
+	//呼び出し元毎に1秒あたりに受け付ける呼び出しの数と、連続して受け付けられる数
+	PerCallerRate  float64 `yaml:"per_caller_rate" json:"per_caller_rate"`
+	PerCallerBurst int     `yaml:"per_caller_burst" json:"per_caller_burst"`
+}
+
+// 制限の設定
+type Config struct {
+	//キーは "/myapp.GreetingService/Hello" のようなFullMethod
+	//"/myapp.GreetingService/" のように/で終わるキーはサービス全体に一致するが、バケットはメソッド毎に分かれる
+	Methods map[string]Rule `yaml:"methods" json:"methods"`
+	//呼び出し元1つが同時に開けるストリームの数 0なら無制限
+	//Methodsに一致するメソッドのストリームだけを数え、ヘルスチェックのWatchなどは数えない
+	MaxStreamsPerCaller int `yaml:"max_streams_per_caller" json:"max_streams_per_caller"`
+}
+
+// 設定が正しいか確認する
+func (c *Config) Compile() error {
+	var errs []string
+	for method, r := range c.Methods {
+		if !strings.HasPrefix(method, "/") {
+			errs = append(errs, fmt.Sprintf("%q must start with /", method))
+		}
+		if err := r.check(); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", method, err))
+		}
+	}
+	if c.MaxStreamsPerCaller < 0 {
+		errs = append(errs, fmt.Sprintf("max_streams_per_caller must not be negative, got %d", c.MaxStreamsPerCaller))
+	}
+	if len(errs) > 0 {
+		sort.Strings(errs)
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func (r Rule) check() error {
+	for _, rate := range []float64{r.Rate, r.PerCallerRate} {
+		if !(rate >= 0) || math.IsInf(rate, 0) {
+			return fmt.Errorf("rate must be a finite non-negative number, got %v", rate)
+		}
+	}
+	if r.Burst < 0 || r.PerCallerBurst < 0 {
+		return fmt.Errorf("burst must not be negative")
+	}
+	return nil
+}
+
+// fullMethodに一致するルール
+// 完全に一致するものを優先し、無ければサービス全体のルールを使う
+func (c *Config) rule(fullMethod string) (Rule, bool) {
+	if r, ok := c.Methods[fullMethod]; ok {
+		return r, true
+	}
+	if i := strings.LastIndex(fullMethod, "/"); i > 0 {
+		if r, ok := c.Methods[fullMethod[:i+1]]; ok {
+			return r, true
+		}
+	}
+	return Rule{}, false
+}
+
+// 使われていないバケットを削除する間隔
+const sweepInterval = time.Minute
+
+// トークンバケットで呼び出しを制限し、呼び出し元毎のストリームの数を数える
+// 設定はUpdateで稼働中に入れ替えられる
+type Limiter struct {
+	mu      sync.Mutex
+	cfg     Config
+	buckets map[bucketKey]*bucket
+	streams map[string]int
+	swept   time.Time
+}
+
+// バケットはメソッドと呼び出し元の組毎に作る メソッド全体のバケットはcallerが空
+type bucketKey struct {
+	method string
+	caller string
+}
+
+// トークンの残りと最後に補充した時刻
+type bucket struct {
+	tokens float64
+	last   time.Time
+	//最後に補充した時の設定
+	rate float64
+	size float64
+}
+
+// 設定を確認してLimiterを作る
+func New(cfg Config) (*Limiter, error) {
+	if err := cfg.Compile(); err != nil {
+		return nil, err
+	}
+	return &Limiter{
+		cfg:     cfg,
+		buckets: make(map[bucketKey]*bucket),
+		streams: make(map[string]int),
+		swept:   time.Now(),
+	}, nil
+}
+
+// 設定を入れ替える
+// バケットに残っているトークンは新しいburstまでに切り詰めて引き継ぎ、開いているストリームはそのまま数える
+func (l *Limiter) Update(cfg Config) error {
+	if err := cfg.Compile(); err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.cfg = cfg
+	return nil
+}
+
+// 呼び出しを受け付けるならトークンを1つ使ってnilを返す
+// 制限を超えていれば、次に受け付けられるまでの時間をRetryInfoに入れたResourceExhaustedを返す
+func (l *Limiter) Allow(ctx context.Context, fullMethod string) error {
+	now := time.Now()
+	caller := Caller(ctx)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sweep(now)
+	rule, ok := l.cfg.rule(fullMethod)
+	if !ok {
+		return nil
+	}
+
+	//両方のバケットにトークンがある場合だけ使う
+	global := l.bucket(bucketKey{method: fullMethod}, rule.Rate, rule.Burst, now)
+	perCaller := l.bucket(bucketKey{method: fullMethod, caller: caller}, rule.PerCallerRate, rule.PerCallerBurst, now)
+	if wait := global.wait(rule.Rate); wait > 0 {
+		return rpcerr.ResourceExhausted(rpcerr.ReasonRateLimited, wait,
+			rpcerr.Quota("method:"+fullMethod, "rate limit of %g requests per second exceeded", rule.Rate))
+	}
+	if wait := perCaller.wait(rule.PerCallerRate); wait > 0 {
+		return rpcerr.ResourceExhausted(rpcerr.ReasonRateLimited, wait,
+			rpcerr.Quota("caller:"+caller, "rate limit of %g requests per second per caller exceeded for %s", rule.PerCallerRate, fullMethod))
+	}
+	global.take()
+	perCaller.take()
+	return nil
+}
+
+// fullMethodのストリームを開く 呼び出し元のストリームが上限に達していればResourceExhaustedを返す
+// ストリームが終わったら返り値の関数を呼ぶ
+func (l *Limiter) OpenStream(ctx context.Context, fullMethod string) (func(), error) {
+	caller := Caller(ctx)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.cfg.rule(fullMethod); !ok {
+		return func() {}, nil
+	}
+	if max := l.cfg.MaxStreamsPerCaller; max > 0 && l.streams[caller] >= max {
+		return nil, rpcerr.ResourceExhausted(rpcerr.ReasonTooManyStreams, 0,
+			rpcerr.Quota("caller:"+caller, "limit of %d concurrent streams per caller exceeded", max))
+	}
+	l.streams[caller]++
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			if l.streams[caller]--; l.streams[caller] <= 0 {
+				delete(l.streams, caller)
+			}
+		})
+	}, nil
+}
+
+// 呼び出し元を表す文字列
+// 認証済みなら "subject:alice"、そうでなければ "peer:127.0.0.1" のように接続元のアドレス(ポートを除く)
+func Caller(ctx context.Context) string {
+	if id, ok := auth.FromContext(ctx); ok && id.Subject != "" {
+		return "subject:" + id.Subject
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		addr := p.Addr.String()
+		if host, _, err := net.SplitHostPort(addr); err == nil {
+			addr = host
+		}
+		return "peer:" + addr
+	}
+	return "unknown"
+}
+
+// keyのバケットをnowまで補充して返す rateが0なら制限しないのでnilを返す
+// 呼び出し元はl.muを持っていること
+func (l *Limiter) bucket(key bucketKey, rate float64, burst int, now time.Time) *bucket {
+	if rate == 0 {
+		return nil
+	}
+	size := float64(burst)
+	if burst == 0 {
+		size = math.Max(1, math.Ceil(rate))
+	}
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: size, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(size, b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last, b.rate, b.size = now, rate, size
+	return b
+}
+
+// トークンが1つ貯まるまでの時間 すぐに使えるなら0
+// ミリ秒に切り上げるのは、grpc-retry-pushback-msで伝えた時間が早すぎないようにするため
+func (b *bucket) wait(rate float64) time.Duration {
+	if b == nil || b.tokens >= 1 {
+		return 0
+	}
+	d := time.Duration((1 - b.tokens) / rate * float64(time.Second))
+	return (d + time.Millisecond - 1).Truncate(time.Millisecond)
+}
+
+func (b *bucket) take() {
+	if b != nil {
+		b.tokens--
+	}
+}
+
+// 満杯まで補充されたバケットを削除する
+// 満杯のバケットは新しく作ったものと同じなので、消しても制限は変わらない
+// 呼び出し元はl.muを持っていること
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.swept) < sweepInterval {
+		return
+	}
+	l.swept = now
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*b.rate >= b.size {
+			delete(l.buckets, key)
+		}
+	}
+}
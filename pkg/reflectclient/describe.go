@@ -0,0 +1,106 @@
+package reflectclient
+
+import (
+	"fmt"
+	"strings"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// 定義をprotoファイルに近い形式の文字列にする
+func Describe(d protoreflect.Descriptor) string {
+	var b strings.Builder
+	switch d := d.(type) {
+	case protoreflect.ServiceDescriptor:
+		fmt.Fprintf(&b, "service %s {\n", d.FullName())
+		for i := 0; i < d.Methods().Len(); i++ {
+			fmt.Fprintf(&b, "  %s\n", methodLine(d.Methods().Get(i)))
+		}
+		b.WriteString("}\n")
+	case protoreflect.MethodDescriptor:
+		fmt.Fprintf(&b, "%s\n", methodLine(d))
+	case protoreflect.MessageDescriptor:
+		writeMessage(&b, d, "")
+	case protoreflect.EnumDescriptor:
+		writeEnum(&b, d, "")
+	case protoreflect.FieldDescriptor:
+		fmt.Fprintf(&b, "%s\n", fieldLine(d))
+	default:
+		fmt.Fprintf(&b, "%s\n", d.FullName())
+	}
+	return b.String()
+}
+
+// rpc Name(stream In) returns (stream Out);
+func methodLine(md protoreflect.MethodDescriptor) string {
+	in, out := string(md.Input().FullName()), string(md.Output().FullName())
+	if md.IsStreamingClient() {
+		in = "stream " + in
+	}
+	if md.IsStreamingServer() {
+		out = "stream " + out
+	}
+	return fmt.Sprintf("rpc %s(%s) returns (%s);", md.Name(), in, out)
+}
+
+func writeMessage(b *strings.Builder, md protoreflect.MessageDescriptor, indent string) {
+	fmt.Fprintf(b, "%smessage %s {\n", indent, md.FullName())
+	for i := 0; i < md.Fields().Len(); i++ {
+		fd := md.Fields().Get(i)
+		//oneofのフィールドはoneofの中にまとめて書く
+		if od := fd.ContainingOneof(); od != nil && !od.IsSynthetic() {
+			if od.Fields().Get(0) != fd {
+				continue
+			}
+			fmt.Fprintf(b, "%s  oneof %s {\n", indent, od.Name())
+			for j := 0; j < od.Fields().Len(); j++ {
+				fmt.Fprintf(b, "%s    %s\n", indent, fieldLine(od.Fields().Get(j)))
+			}
+			fmt.Fprintf(b, "%s  }\n", indent)
+			continue
+		}
+		fmt.Fprintf(b, "%s  %s\n", indent, fieldLine(fd))
+	}
+	for i := 0; i < md.Enums().Len(); i++ {
+		writeEnum(b, md.Enums().Get(i), indent+"  ")
+	}
+	for i := 0; i < md.Messages().Len(); i++ {
+		if nested := md.Messages().Get(i); !nested.IsMapEntry() {
+			writeMessage(b, nested, indent+"  ")
+		}
+	}
+	fmt.Fprintf(b, "%s}\n", indent)
+}
+
+func writeEnum(b *strings.Builder, ed protoreflect.EnumDescriptor, indent string) {
+	fmt.Fprintf(b, "%senum %s {\n", indent, ed.FullName())
+	for i := 0; i < ed.Values().Len(); i++ {
+		v := ed.Values().Get(i)
+		fmt.Fprintf(b, "%s  %s = %d;\n", indent, v.Name(), v.Number())
+	}
+	fmt.Fprintf(b, "%s}\n", indent)
+}
+
+// repeated string names = 1;
+func fieldLine(fd protoreflect.FieldDescriptor) string {
+	var label string
+	switch {
+	case fd.IsMap():
+		return fmt.Sprintf("map<%s, %s> %s = %d;", typeName(fd.MapKey()), typeName(fd.MapValue()), fd.Name(), fd.Number())
+	case fd.IsList():
+		label = "repeated "
+	case fd.HasOptionalKeyword():
+		label = "optional "
+	}
+	return fmt.Sprintf("%s%s %s = %d;", label, typeName(fd), fd.Name(), fd.Number())
+}
+
+func typeName(fd protoreflect.FieldDescriptor) string {
+	switch fd.Kind() {
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return string(fd.Message().FullName())
+	case protoreflect.EnumKind:
+		return string(fd.Enum().FullName())
+	}
+	return fd.Kind().String()
+}
@@ -0,0 +1,189 @@
+package reflectclient
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"google.golang.org/grpc"
+	rpb "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// serverのリフレクションサービスからprotoの定義を取得する
+// 取得したファイルは保持しておき、同じファイルは2回取得しない
+type Client struct {
+	stub rpb.ServerReflectionClient
+
+	mu    sync.Mutex
+	files *protoregistry.Files
+}
+
+func New(cc grpc.ClientConnInterface) *Client {
+	return &Client{stub: rpb.NewServerReflectionClient(cc), files: new(protoregistry.Files)}
+}
+
+// serverが公開しているサービスの名前を返す
+func (c *Client) ListServices(ctx context.Context) ([]string, error) {
+	res, err := c.call(ctx, &rpb.ServerReflectionRequest{
+		MessageRequest: &rpb.ServerReflectionRequest_ListServices{ListServices: "*"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(res.GetListServicesResponse().GetService()))
+	for _, s := range res.GetListServicesResponse().GetService() {
+		names = append(names, s.GetName())
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// 完全修飾名でサービス・メソッド・メッセージ・列挙型などの定義を探す
+func (c *Client) FindSymbol(ctx context.Context, name string) (protoreflect.Descriptor, error) {
+	name = strings.TrimPrefix(name, ".")
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if d, err := c.files.FindDescriptorByName(protoreflect.FullName(name)); err == nil {
+		return d, nil
+	}
+	res, err := c.call(ctx, &rpb.ServerReflectionRequest{
+		MessageRequest: &rpb.ServerReflectionRequest_FileContainingSymbol{FileContainingSymbol: name},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := c.register(ctx, res.GetFileDescriptorResponse().GetFileDescriptorProto()); err != nil {
+		return nil, err
+	}
+	return c.files.FindDescriptorByName(protoreflect.FullName(name))
+}
+
+// サービスの定義を返す
+func (c *Client) Service(ctx context.Context, name string) (protoreflect.ServiceDescriptor, error) {
+	d, err := c.FindSymbol(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	sd, ok := d.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a service", name)
+	}
+	return sd, nil
+}
+
+// メソッドの定義を返す
+// nameは "pkg.Service/Method" と "pkg.Service.Method" のどちらでもよい
+func (c *Client) Method(ctx context.Context, name string) (protoreflect.MethodDescriptor, error) {
+	name = strings.TrimPrefix(name, "/")
+	i := strings.LastIndexAny(name, "/.")
+	if i < 0 {
+		return nil, fmt.Errorf("method %q must be qualified with its service, e.g. pkg.Service/Method", name)
+	}
+	sd, err := c.Service(ctx, name[:i])
+	if err != nil {
+		return nil, err
+	}
+	md := sd.Methods().ByName(protoreflect.Name(name[i+1:]))
+	if md == nil {
+		return nil, fmt.Errorf("service %s has no method %s", sd.FullName(), name[i+1:])
+	}
+	return md, nil
+}
+
+// メソッドを呼び出す時のパス "/pkg.Service/Method"
+func FullMethod(md protoreflect.MethodDescriptor) string {
+	return fmt.Sprintf("/%s/%s", md.Parent().FullName(), md.Name())
+}
+
+// 受け取ったファイルを依存するファイルから順に登録する
+// 足りない依存ファイルはファイル名で取得する
+func (c *Client) register(ctx context.Context, raw [][]byte) error {
+	pending := make(map[string]*descriptorpb.FileDescriptorProto, len(raw))
+	for _, b := range raw {
+		fd := new(descriptorpb.FileDescriptorProto)
+		if err := proto.Unmarshal(b, fd); err != nil {
+			return fmt.Errorf("reflection: malformed file descriptor: %w", err)
+		}
+		pending[fd.GetName()] = fd
+	}
+
+	var add func(name string) error
+	add = func(name string) error {
+		if _, err := c.files.FindFileByPath(name); err == nil {
+			return nil
+		}
+		fd, ok := pending[name]
+		if !ok {
+			res, err := c.call(ctx, &rpb.ServerReflectionRequest{
+				MessageRequest: &rpb.ServerReflectionRequest_FileByFilename{FileByFilename: name},
+			})
+			if err != nil {
+				return err
+			}
+			for _, b := range res.GetFileDescriptorResponse().GetFileDescriptorProto() {
+				fd := new(descriptorpb.FileDescriptorProto)
+				if err := proto.Unmarshal(b, fd); err != nil {
+					return fmt.Errorf("reflection: malformed file descriptor: %w", err)
+				}
+				if _, ok := pending[fd.GetName()]; !ok {
+					pending[fd.GetName()] = fd
+				}
+			}
+			if fd, ok = pending[name]; !ok {
+				return fmt.Errorf("reflection: server did not return %s", name)
+			}
+		}
+		//循環しないように先に取り除いておく
+		delete(pending, name)
+		for _, dep := range fd.GetDependency() {
+			if err := add(dep); err != nil {
+				return err
+			}
+		}
+		f, err := protodesc.NewFile(fd, c.files)
+		if err != nil {
+			return fmt.Errorf("reflection: %s: %w", name, err)
+		}
+		return c.files.RegisterFile(f)
+	}
+
+	names := make([]string, 0, len(pending))
+	for name := range pending {
+		names = append(names, name)
+	}
+	for _, name := range names {
+		if err := add(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// リフレクションサービスに1つ問い合わせる
+func (c *Client) call(ctx context.Context, req *rpb.ServerReflectionRequest) (*rpb.ServerReflectionResponse, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := c.stub.ServerReflectionInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := stream.Send(req); err != nil {
+		return nil, err
+	}
+	res, err := stream.Recv()
+	if err != nil {
+		return nil, err
+	}
+	stream.CloseSend()
+	if e := res.GetErrorResponse(); e != nil {
+		return nil, fmt.Errorf("reflection: %s (code %d)", e.GetErrorMessage(), e.GetErrorCode())
+	}
+	return res, nil
+}
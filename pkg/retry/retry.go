@@ -0,0 +1,10 @@
+package retry
+
+// gRPCのリトライとヘッジングで使うメタデータのキー
+// server, client, faultで同じ値を使うためにここで定義する
+const (
+	//2回目以降の試行に付く、それまでの試行回数のメタデータ
+	PreviousAttemptsKey = "grpc-previous-rpc-attempts"
+	//serverが次の試行までの待ち時間をミリ秒で指定するトレイラー
+	PushbackKey = "grpc-retry-pushback-ms"
+)
@@ -0,0 +1,146 @@
+package rpcerr
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// ErrorInfoのdomain
+const Domain = "grpctutorial"
+
+// ErrorInfoのreason
+const (
+	ReasonInvalidArgument = "INVALID_ARGUMENT"
+	ReasonQuotaExceeded   = "QUOTA_EXCEEDED"
+	ReasonShuttingDown    = "SHUTTING_DOWN"
+	ReasonIdleTimeout     = "IDLE_TIMEOUT"
+	ReasonFaultInjected   = "FAULT_INJECTED"
+	ReasonRateLimited     = "RATE_LIMITED"
+	ReasonTooManyStreams  = "TOO_MANY_STREAMS"
+)
+
+// BadRequestのフィールド1つ分の違反
+func Field(field, format string, args ...interface{}) *errdetails.BadRequest_FieldViolation {
+	return &errdetails.BadRequest_FieldViolation{Field: field, Description: fmt.Sprintf(format, args...)}
+}
+
+// フィールドの違反をBadRequestとErrorInfoに入れたInvalidArgumentを返す
+func InvalidArgument(violations ...*errdetails.BadRequest_FieldViolation) error {
+	descs := make([]string, 0, len(violations))
+	for _, v := range violations {
+		descs = append(descs, v.GetField()+": "+v.GetDescription())
+	}
+	return New(codes.InvalidArgument, strings.Join(descs, "; "),
+		&errdetails.BadRequest{FieldViolations: violations},
+		Info(ReasonInvalidArgument, nil),
+	)
+}
+
+// 制限を超えたことをQuotaFailureに入れたResourceExhaustedを返す
+// retryAfterが0でなければRetryInfoも付ける
+func ResourceExhausted(reason string, retryAfter time.Duration, violations ...*errdetails.QuotaFailure_Violation) error {
+	descs := make([]string, 0, len(violations))
+	for _, v := range violations {
+		descs = append(descs, v.GetDescription())
+	}
+	details := []proto.Message{&errdetails.QuotaFailure{Violations: violations}, Info(reason, nil)}
+	if retryAfter > 0 {
+		details = append(details, Retry(retryAfter))
+	}
+	return New(codes.ResourceExhausted, strings.Join(descs, "; "), details...)
+}
+
+// QuotaFailureの違反1つ分
+func Quota(subject, format string, args ...interface{}) *errdetails.QuotaFailure_Violation {
+	return &errdetails.QuotaFailure_Violation{Subject: subject, Description: fmt.Sprintf(format, args...)}
+}
+
+// retryAfter後にやり直せることをRetryInfoに入れたUnavailableを返す
+func Unavailable(reason, msg string, retryAfter time.Duration) error {
+	return New(codes.Unavailable, msg, Info(reason, nil), Retry(retryAfter))
+}
+
+// Domainを付けたErrorInfo
+func Info(reason string, metadata map[string]string) *errdetails.ErrorInfo {
+	return &errdetails.ErrorInfo{Reason: reason, Domain: Domain, Metadata: metadata}
+}
+
+// やり直すまでの待ち時間
+func Retry(after time.Duration) *errdetails.RetryInfo {
+	return &errdetails.RetryInfo{RetryDelay: durationpb.New(after)}
+}
+
+// 詳細を付けたステータスのエラーを返す
+// Anyに変換できなかった詳細は省く
+func New(code codes.Code, msg string, details ...proto.Message) error {
+	p := status.New(code, msg).Proto()
+	for _, d := range details {
+		a, err := anypb.New(d)
+		if err != nil {
+			continue
+		}
+		p.Details = append(p.Details, a)
+	}
+	return status.FromProto(p).Err()
+}
+
+// エラーに含まれる詳細を人が読める形式で1行ずつ返す
+func Describe(err error) []string {
+	var lines []string
+	for _, d := range status.Convert(err).Details() {
+		switch d := d.(type) {
+		case *errdetails.BadRequest:
+			for _, v := range d.GetFieldViolations() {
+				lines = append(lines, fmt.Sprintf("bad request: %s: %s", v.GetField(), v.GetDescription()))
+			}
+		case *errdetails.QuotaFailure:
+			for _, v := range d.GetViolations() {
+				lines = append(lines, fmt.Sprintf("quota failure: %s: %s", v.GetSubject(), v.GetDescription()))
+			}
+		case *errdetails.RetryInfo:
+			lines = append(lines, fmt.Sprintf("retry after: %v", d.GetRetryDelay().AsDuration()))
+		case *errdetails.ErrorInfo:
+			line := fmt.Sprintf("error info: reason=%s domain=%s", d.GetReason(), d.GetDomain())
+			keys := make([]string, 0, len(d.GetMetadata()))
+			for k := range d.GetMetadata() {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				line += fmt.Sprintf(" %s=%s", k, d.GetMetadata()[k])
+			}
+			lines = append(lines, line)
+		case *errdetails.PreconditionFailure:
+			for _, v := range d.GetViolations() {
+				lines = append(lines, fmt.Sprintf("precondition failure: %s %s: %s", v.GetType(), v.GetSubject(), v.GetDescription()))
+			}
+		case *errdetails.LocalizedMessage:
+			lines = append(lines, fmt.Sprintf("message (%s): %s", d.GetLocale(), d.GetMessage()))
+		case *errdetails.Help:
+			for _, l := range d.GetLinks() {
+				lines = append(lines, fmt.Sprintf("help: %s %s", l.GetDescription(), l.GetUrl()))
+			}
+		case *errdetails.DebugInfo:
+			lines = append(lines, fmt.Sprintf("debug info: %s", d.GetDetail()))
+		case *errdetails.RequestInfo:
+			lines = append(lines, fmt.Sprintf("request info: id=%s", d.GetRequestId()))
+		case *errdetails.ResourceInfo:
+			lines = append(lines, fmt.Sprintf("resource info: %s %s: %s", d.GetResourceType(), d.GetResourceName(), d.GetDescription()))
+		case error:
+			//型が登録されていない詳細
+			lines = append(lines, fmt.Sprintf("unknown detail: %v", d))
+		default:
+			lines = append(lines, fmt.Sprintf("detail: %v", d))
+		}
+	}
+	return lines
+}
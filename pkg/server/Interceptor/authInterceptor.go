@@ -0,0 +1,72 @@
+package Interceptors
+
+import (
+	"context"
+	"errors"
+
+	"grpctutorial/pkg/auth"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// メタデータのbearerトークンを検証し、FullMethod毎のルールで認可するUnaryインターセプター
+// 認証された呼び出し元はauth.FromContextで取得できる
+func AuthUnaryServerInterceptor(authn auth.Authenticator, policy *auth.Policy) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := authorize(ctx, info.FullMethod, authn, policy)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// Stream版の認証・認可インターセプター
+func AuthStreamServerInterceptor(authn auth.Authenticator, policy *auth.Policy) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := authorize(ss.Context(), info.FullMethod, authn, policy)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &authServerStream{ss, ctx})
+	}
+}
+
+// 呼び出し元を格納したコンテキストを返すストリーム
+type authServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authServerStream) Context() context.Context {
+	return s.ctx
+}
+
+// 認証・認可を行い、呼び出し元を格納したコンテキストを返す
+func authorize(ctx context.Context, fullMethod string, authn auth.Authenticator, policy *auth.Policy) (context.Context, error) {
+	rule := policy.Rule(fullMethod)
+	if rule.Public {
+		return ctx, nil
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	token, err := auth.TokenFromMetadata(md)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	id, err := authn.Authenticate(token)
+	if err != nil {
+		//トークンの詳細な不備は呼び出し元に返さない
+		return nil, status.Error(codes.Unauthenticated, auth.ErrInvalidToken.Error())
+	}
+	if err := rule.Authorize(id); err != nil {
+		if errors.Is(err, auth.ErrPermissionDenied) {
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		}
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return auth.NewContext(ctx, id), nil
+}
@@ -0,0 +1,106 @@
+package Interceptors
+
+import (
+	"context"
+	"testing"
+
+	"grpctutorial/pkg/auth"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestAuthUnaryServerInterceptor(t *testing.T) {
+	authn := auth.StaticKeys{
+		"user-key":   {Subject: "alice", Roles: []string{"user"}},
+		"banned-key": {Subject: "mallory", Roles: []string{"user", "banned"}},
+	}
+	policy := &auth.Policy{
+		Default: auth.Rule{AllowRoles: []string{"user"}, DenyRoles: []string{"banned"}},
+		Methods: map[string]auth.Rule{
+			"/grpc.health.v1.Health/":      {Public: true},
+			"/myapp.GreetingService/Admin": {AllowRoles: []string{"admin"}},
+		},
+	}
+	interceptor := AuthUnaryServerInterceptor(authn, policy)
+
+	tests := []struct {
+		name   string
+		method string
+		//authorizationメタデータ 空なら付けない
+		authorization string
+
+		wantCode codes.Code
+		//ハンドラから見える呼び出し元 空なら呼び出し元が無い
+		wantSubject string
+	}{
+		{
+			//Publicなメソッドはトークンが無くても呼べる
+			name:   "public method skips auth",
+			method: "/grpc.health.v1.Health/Check",
+		},
+		{
+			name:          "public method ignores a bad token",
+			method:        "/grpc.health.v1.Health/Check",
+			authorization: "Bearer wrong",
+		},
+		{
+			name:     "missing token",
+			method:   "/myapp.GreetingService/Hello",
+			wantCode: codes.Unauthenticated,
+		},
+		{
+			name:          "invalid token",
+			method:        "/myapp.GreetingService/Hello",
+			authorization: "Bearer wrong",
+			wantCode:      codes.Unauthenticated,
+		},
+		{
+			name:          "allowed role",
+			method:        "/myapp.GreetingService/Hello",
+			authorization: "Bearer user-key",
+			wantSubject:   "alice",
+		},
+		{
+			name:          "denied role",
+			method:        "/myapp.GreetingService/Hello",
+			authorization: "Bearer banned-key",
+			wantCode:      codes.PermissionDenied,
+		},
+		{
+			name:          "missing allowed role",
+			method:        "/myapp.GreetingService/Admin",
+			authorization: "Bearer user-key",
+			wantCode:      codes.PermissionDenied,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.authorization != "" {
+				ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("authorization", tt.authorization))
+			}
+			called := false
+			handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+				called = true
+				id, ok := auth.FromContext(ctx)
+				if tt.wantSubject == "" && ok {
+					t.Errorf("handler got identity %+v, want none", id)
+				}
+				if tt.wantSubject != "" && (!ok || id.Subject != tt.wantSubject) {
+					t.Errorf("handler got identity %+v, want subject %s", id, tt.wantSubject)
+				}
+				return "ok", nil
+			}
+			_, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: tt.method}, handler)
+			if status.Code(err) != tt.wantCode {
+				t.Fatalf("status = %s (%v), want %s", status.Code(err), err, tt.wantCode)
+			}
+			if called != (tt.wantCode == codes.OK) {
+				t.Errorf("handler called = %v, want %v", called, tt.wantCode == codes.OK)
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package Interceptors
+
+import (
+	"log/slog"
+
+	"grpctutorial/pkg/auth"
+	"grpctutorial/pkg/chain"
+	"grpctutorial/pkg/fault"
+	"grpctutorial/pkg/ratelimit"
+	"grpctutorial/pkg/tracing"
+	"grpctutorial/pkg/validate"
+
+	"google.golang.org/grpc"
+)
+
+// serverのインターセプターのUnary版とStream版の組
+type Interceptor = chain.Interceptor[grpc.UnaryServerInterceptor, grpc.StreamServerInterceptor]
+
+// 名前からInterceptorを作るfactoryの登録先
+type Registry = chain.Registry[Interceptor]
+
+// 引数なしで作れるインターセプターを登録したRegistryを返す
+// 設定が必要なものは呼び出し側でRegisterする
+func NewRegistry() *Registry {
+	r := chain.NewRegistry[Interceptor]()
+	r.Register("example", func(opts chain.Options) (Interceptor, error) {
+		if err := opts.Check(); err != nil {
+			return Interceptor{}, err
+		}
+		return Interceptor{Unary: MyUnaryServerInterceptor1, Stream: MyStreamServerInterceptor1}, nil
+	})
+	r.Register("recovery", func(opts chain.Options) (Interceptor, error) {
+		if err := opts.Check(); err != nil {
+			return Interceptor{}, err
+		}
+		return Interceptor{Unary: RecoveryUnaryServerInterceptor, Stream: RecoveryStreamServerInterceptor}, nil
+	})
+	return r
+}
+
+// loggingインターセプターのfactory
+func LoggingFactory(logger *slog.Logger) func(chain.Options) (Interceptor, error) {
+	return func(opts chain.Options) (Interceptor, error) {
+		if err := opts.Check(); err != nil {
+			return Interceptor{}, err
+		}
+		return Interceptor{Unary: LoggingUnaryServerInterceptor(logger), Stream: LoggingStreamServerInterceptor(logger)}, nil
+	}
+}
+
+// metricsインターセプターのfactory
+func MetricsFactory(m *ServerMetrics) func(chain.Options) (Interceptor, error) {
+	return func(opts chain.Options) (Interceptor, error) {
+		if err := opts.Check(); err != nil {
+			return Interceptor{}, err
+		}
+		return Interceptor{Unary: m.UnaryServerInterceptor(), Stream: m.StreamServerInterceptor()}, nil
+	}
+}
+
+// tracingインターセプターのfactory
+func TracingFactory(tracer *tracing.Tracer) func(chain.Options) (Interceptor, error) {
+	return func(opts chain.Options) (Interceptor, error) {
+		if err := opts.Check(); err != nil {
+			return Interceptor{}, err
+		}
+		return Interceptor{Unary: TracingUnaryServerInterceptor(tracer), Stream: TracingStreamServerInterceptor(tracer)}, nil
+	}
+}
+
+// authインターセプターのfactory
+func AuthFactory(authn auth.Authenticator, policy *auth.Policy) func(chain.Options) (Interceptor, error) {
+	return func(opts chain.Options) (Interceptor, error) {
+		if err := opts.Check(); err != nil {
+			return Interceptor{}, err
+		}
+		return Interceptor{Unary: AuthUnaryServerInterceptor(authn, policy), Stream: AuthStreamServerInterceptor(authn, policy)}, nil
+	}
+}
+
+// validationインターセプターのfactory
+func ValidationFactory(policy *validate.Policy) func(chain.Options) (Interceptor, error) {
+	return func(opts chain.Options) (Interceptor, error) {
+		if err := opts.Check(); err != nil {
+			return Interceptor{}, err
+		}
+		return Interceptor{Unary: ValidationUnaryServerInterceptor(policy), Stream: ValidationStreamServerInterceptor(policy)}, nil
+	}
+}
+
+// faultインターセプターのfactory
+func FaultFactory(policy *fault.Policy) func(chain.Options) (Interceptor, error) {
+	return func(opts chain.Options) (Interceptor, error) {
+		if err := opts.Check(); err != nil {
+			return Interceptor{}, err
+		}
+		return Interceptor{Unary: FaultUnaryServerInterceptor(policy), Stream: FaultStreamServerInterceptor(policy)}, nil
+	}
+}
+
+// ratelimitインターセプターのfactory
+func RateLimitFactory(l *ratelimit.Limiter) func(chain.Options) (Interceptor, error) {
+	return func(opts chain.Options) (Interceptor, error) {
+		if err := opts.Check(); err != nil {
+			return Interceptor{}, err
+		}
+		return Interceptor{Unary: RateLimitUnaryServerInterceptor(l), Stream: RateLimitStreamServerInterceptor(l)}, nil
+	}
+}
+
+// 先頭が一番外側になるように並べたインターセプター
+type Chain = chain.Chain[grpc.UnaryServerInterceptor, grpc.StreamServerInterceptor]
+
+// grpc.NewServerに渡すオプション
+func ServerOptions(c Chain) []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(c.Unaries()...),
+		grpc.ChainStreamInterceptor(c.Streams()...),
+	}
+}
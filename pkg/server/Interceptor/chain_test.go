@@ -0,0 +1,171 @@
+package Interceptors
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"grpctutorial/pkg/chain"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// インターセプターが呼ばれた順番を記録する
+type recorder struct {
+	mu    sync.Mutex
+	calls []string
+}
+
+func (r *recorder) add(call string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = append(r.calls, call)
+}
+
+func (r *recorder) take() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	calls := r.calls
+	r.calls = nil
+	return calls
+}
+
+// 前処理と後処理でnameを記録するインターセプターのfactory
+// unaryOnlyならStream版を作らない
+func recordingFactory(r *recorder, name string, unaryOnly bool) func(chain.Options) (Interceptor, error) {
+	return func(opts chain.Options) (Interceptor, error) {
+		if err := opts.Check(); err != nil {
+			return Interceptor{}, err
+		}
+		i := Interceptor{
+			Unary: func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+				r.add(name + " pre")
+				res, err := handler(ctx, req)
+				r.add(name + " post")
+				return res, err
+			},
+		}
+		if !unaryOnly {
+			i.Stream = func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+				r.add(name + " pre")
+				err := handler(srv, ss)
+				r.add(name + " post")
+				return err
+			}
+		}
+		return i, nil
+	}
+}
+
+func TestChainOrder(t *testing.T) {
+	r := &recorder{}
+	registry := NewRegistry()
+	registry.Register("a", recordingFactory(r, "a", false))
+	registry.Register("b", recordingFactory(r, "b", true))
+	registry.Register("c", recordingFactory(r, "c", false))
+
+	c, err := chain.Build(registry, []chain.Spec{{Name: "c"}, {Name: "a"}, {Name: "b"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer(ServerOptions(c)...)
+	healthpb.RegisterHealthServer(srv, health.NewServer())
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	ctx := context.Background()
+	conn, err := grpc.DialContext(ctx, "bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := healthpb.NewHealthClient(conn)
+
+	tests := []struct {
+		name string
+		call func() error
+		want []string
+	}{
+		{
+			name: "unary",
+			call: func() error {
+				_, err := client.Check(ctx, &healthpb.HealthCheckRequest{})
+				return err
+			},
+			want: []string{"c pre", "a pre", "b pre", "b post", "a post", "c post"},
+		},
+		{
+			//bはUnary版しかないのでストリームには適用されない
+			name: "stream",
+			call: func() error {
+				//最初の状態を受け取ったら取り消してハンドラを終わらせる
+				ctx, cancel := context.WithCancel(ctx)
+				defer cancel()
+				stream, err := client.Watch(ctx, &healthpb.HealthCheckRequest{})
+				if err != nil {
+					return err
+				}
+				_, err = stream.Recv()
+				return err
+			},
+			want: []string{"c pre", "a pre", "a post", "c post"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.call(); err != nil {
+				t.Fatal(err)
+			}
+			waitCalls(t, r, len(tt.want))
+			if got := r.take(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("calls = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// ストリームの後処理はクライアントが結果を受け取った後に走ることがあるので、n件記録されるまで待つ
+func waitCalls(t *testing.T, r *recorder, n int) {
+	t.Helper()
+	for i := 0; i < 1000; i++ {
+		r.mu.Lock()
+		got := len(r.calls)
+		r.mu.Unlock()
+		if got >= n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("only %d of %d calls were recorded", len(r.take()), n)
+}
+
+func TestRegistryOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    chain.Spec
+		wantErr bool
+	}{
+		{"recovery", chain.Spec{Name: "recovery"}, false},
+		{"unknown option", chain.Spec{Name: "recovery", Options: chain.Options{"x": "1"}}, true},
+		{"unknown name", chain.Spec{Name: "missing"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := chain.Build(NewRegistry(), []chain.Spec{tt.spec})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Build error = %v, wantErr %t", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,31 @@
+package Interceptors
+
+import (
+	"context"
+
+	"grpctutorial/pkg/fault"
+
+	"google.golang.org/grpc"
+)
+
+// FullMethod毎のルールで遅延やエラーを注入するUnaryインターセプター
+// クライアントのリトライやヘッジングを試すために使う
+func FaultUnaryServerInterceptor(policy *fault.Policy) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := policy.Inject(ctx, info.FullMethod); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// Stream版の障害注入インターセプター
+// ストリームの開始時に注入する
+func FaultStreamServerInterceptor(policy *fault.Policy) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := policy.Inject(ss.Context(), info.FullMethod); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
@@ -0,0 +1,166 @@
+package Interceptors
+
+import (
+	"context"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"grpctutorial/pkg/logging"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// リクエストIDを付けたロガーをコンテキストに格納し、呼び出し結果を記録するUnaryインターセプター
+// ハンドラではlogging.FromContextでロガーを取得できる
+func LoggingUnaryServerInterceptor(logger *slog.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		ctx, l := requestLogger(ctx, logger, info.FullMethod)
+
+		res, err := handler(ctx, req)
+
+		//リクエストIDを成功した場合はヘッダー、失敗した場合はトレイラーで返す
+		//エラーをトレイラーだけの応答にしておかないと、クライアントはリトライしない
+		md := metadata.Pairs(logging.RequestIDKey, logging.RequestID(ctx))
+		if err != nil {
+			grpc.SetTrailer(ctx, md)
+		} else if herr := grpc.SetHeader(ctx, md); herr != nil {
+			l.Warn("failed to set request id header", "error", herr)
+		}
+
+		logResult(ctx, l, "finished unary call", err, slog.Duration("latency", time.Since(start)))
+		return res, err
+	}
+}
+
+// Stream版のロギングインターセプター
+// 送受信したメッセージの数も記録する
+func LoggingStreamServerInterceptor(logger *slog.Logger) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		ctx, l := requestLogger(ss.Context(), logger, info.FullMethod)
+
+		//リクエストIDは最初にヘッダーを送る時に付ける
+		//ヘッダーを送らずに失敗した場合はトレイラーで返す
+		stream := &loggingServerStream{ServerStream: ss, ctx: ctx, logger: l}
+		err := handler(srv, stream)
+		if !stream.headerSent.Load() {
+			md := metadata.Pairs(logging.RequestIDKey, logging.RequestID(ctx))
+			if err != nil {
+				ss.SetTrailer(md)
+			} else {
+				stream.setRequestID()
+			}
+		}
+
+		logResult(ctx, l, "finished stream call", err,
+			slog.Duration("latency", time.Since(start)),
+			slog.Int64("msgs_sent", stream.sent.Load()),
+			slog.Int64("msgs_received", stream.received.Load()),
+		)
+		return err
+	}
+}
+
+// ロガーを格納したコンテキストを返し、送受信したメッセージを数えるストリーム
+type loggingServerStream struct {
+	grpc.ServerStream
+	ctx      context.Context
+	logger   *slog.Logger
+	sent     atomic.Int64
+	received atomic.Int64
+	//リクエストIDをヘッダーに付けたか
+	headerSent atomic.Bool
+}
+
+func (s *loggingServerStream) Context() context.Context {
+	return s.ctx
+}
+
+// ヘッダーにリクエストIDを付ける 2回目以降は何もしない
+func (s *loggingServerStream) setRequestID() {
+	if s.headerSent.Swap(true) {
+		return
+	}
+	if err := s.ServerStream.SetHeader(metadata.Pairs(logging.RequestIDKey, logging.RequestID(s.ctx))); err != nil {
+		s.logger.Warn("failed to set request id header", "error", err)
+	}
+}
+
+func (s *loggingServerStream) SendHeader(md metadata.MD) error {
+	s.setRequestID()
+	return s.ServerStream.SendHeader(md)
+}
+
+func (s *loggingServerStream) SendMsg(m interface{}) error {
+	s.setRequestID()
+	err := s.ServerStream.SendMsg(m)
+	if err == nil {
+		s.sent.Add(1)
+	}
+	return err
+}
+
+func (s *loggingServerStream) RecvMsg(m interface{}) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil {
+		s.received.Add(1)
+	}
+	return err
+}
+
+// リクエストIDを決め、呼び出し毎のフィールドを付けたロガーをctxに格納する
+// リクエストIDはメタデータのx-request-idを優先し、無ければ新しく作る
+func requestLogger(ctx context.Context, logger *slog.Logger, method string) (context.Context, *slog.Logger) {
+	id := ""
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if v := md.Get(logging.RequestIDKey); len(v) > 0 && logging.ValidRequestID(v[0]) {
+			id = v[0]
+		}
+	}
+	if id == "" {
+		id = logging.NewRequestID()
+	}
+
+	addr := "unknown"
+	if p, ok := peer.FromContext(ctx); ok {
+		addr = p.Addr.String()
+	}
+
+	l := logger.With(
+		slog.String("request_id", id),
+		slog.String("method", method),
+		slog.String("peer", addr),
+	)
+	ctx = logging.WithRequestID(ctx, id)
+	ctx = logging.NewContext(ctx, l)
+	return ctx, l
+}
+
+// ステータスコードに応じたレベルで呼び出し結果を記録する
+func logResult(ctx context.Context, l *slog.Logger, msg string, err error, attrs ...slog.Attr) {
+	code := status.Code(err)
+	attrs = append(attrs, slog.String("code", code.String()))
+	if err != nil {
+		attrs = append(attrs, slog.String("error", status.Convert(err).Message()))
+	}
+	l.LogAttrs(ctx, levelFor(code), msg, attrs...)
+}
+
+// 呼び出し元の問題によるエラーはWarn、server側の問題によるエラーはErrorにする
+func levelFor(code codes.Code) slog.Level {
+	switch code {
+	case codes.OK:
+		return slog.LevelInfo
+	case codes.Canceled, codes.InvalidArgument, codes.NotFound, codes.AlreadyExists,
+		codes.PermissionDenied, codes.Unauthenticated, codes.ResourceExhausted,
+		codes.FailedPrecondition, codes.Aborted, codes.OutOfRange, codes.DeadlineExceeded:
+		return slog.LevelWarn
+	}
+	return slog.LevelError
+}
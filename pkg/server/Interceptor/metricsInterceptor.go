@@ -0,0 +1,128 @@
+package Interceptors
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"grpctutorial/pkg/metrics"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// RPCのメトリクス
+// grpc_type, grpc_service, grpc_method のラベルで集計する
+type ServerMetrics struct {
+	started  *metrics.CounterVec
+	handled  *metrics.CounterVec
+	latency  *metrics.HistogramVec
+	inFlight *metrics.GaugeVec
+	received *metrics.CounterVec
+	sent     *metrics.CounterVec
+}
+
+// regにRPCのメトリクスを登録する
+func NewServerMetrics(reg *metrics.Registry) *ServerMetrics {
+	labels := []string{"grpc_type", "grpc_service", "grpc_method"}
+	m := &ServerMetrics{
+		started: reg.NewCounterVec("grpc_server_started_total",
+			"Total number of RPCs started on the server.", labels...),
+		handled: reg.NewCounterVec("grpc_server_handled_total",
+			"Total number of RPCs completed on the server, regardless of success or failure.", append(labels, "grpc_code")...),
+		latency: reg.NewHistogramVec("grpc_server_handling_seconds",
+			"Histogram of response latency (seconds) of RPCs handled by the server.", metrics.DefBuckets, labels...),
+		inFlight: reg.NewGaugeVec("grpc_server_in_flight",
+			"Number of RPCs currently being handled by the server.", labels...),
+		received: reg.NewCounterVec("grpc_server_msg_received_total",
+			"Total number of stream messages received from the client.", labels...),
+		sent: reg.NewCounterVec("grpc_server_msg_sent_total",
+			"Total number of stream messages sent by the server.", labels...),
+	}
+	reg.NewCounterFunc("grpc_server_panics_recovered_total",
+		"Total number of panics recovered by the recovery interceptor.", nil,
+		func() []metrics.Sample { return []metrics.Sample{{Value: float64(PanicCount())}} })
+	return m
+}
+
+// メトリクスを記録するUnaryインターセプター
+func (m *ServerMetrics) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		labels := methodLabels("unary", info.FullMethod)
+		done := m.start(labels)
+		m.received.Inc(labels...)
+
+		res, err := handler(ctx, req)
+
+		if err == nil {
+			m.sent.Inc(labels...)
+		}
+		done(err)
+		return res, err
+	}
+}
+
+// メトリクスを記録するStreamインターセプター
+// 送受信したメッセージもストリーム毎に数える
+func (m *ServerMetrics) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		labels := methodLabels(streamType(info), info.FullMethod)
+		done := m.start(labels)
+
+		err := handler(srv, &metricsServerStream{ss, m, labels})
+
+		done(err)
+		return err
+	}
+}
+
+// RPCの開始を記録し、終了時に呼ぶ関数を返す
+func (m *ServerMetrics) start(labels []string) func(err error) {
+	start := time.Now()
+	m.started.Inc(labels...)
+	m.inFlight.Add(1, labels...)
+	return func(err error) {
+		m.inFlight.Add(-1, labels...)
+		m.handled.Inc(append(labels, status.Code(err).String())...)
+		m.latency.Observe(time.Since(start).Seconds(), labels...)
+	}
+}
+
+// 送受信したメッセージを数えるストリーム
+type metricsServerStream struct {
+	grpc.ServerStream
+	m      *ServerMetrics
+	labels []string
+}
+
+func (s *metricsServerStream) SendMsg(m interface{}) error {
+	err := s.ServerStream.SendMsg(m)
+	if err == nil {
+		s.m.sent.Inc(s.labels...)
+	}
+	return err
+}
+
+func (s *metricsServerStream) RecvMsg(m interface{}) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil {
+		s.m.received.Inc(s.labels...)
+	}
+	return err
+}
+
+// "/myapp.GreetingService/Hello" を grpc_type, grpc_service, grpc_method のラベルの値に分ける
+func methodLabels(typ, fullMethod string) []string {
+	service, method, _ := strings.Cut(strings.TrimPrefix(fullMethod, "/"), "/")
+	return []string{typ, service, method}
+}
+
+func streamType(info *grpc.StreamServerInfo) string {
+	switch {
+	case info.IsClientStream && info.IsServerStream:
+		return "bidi_stream"
+	case info.IsClientStream:
+		return "client_stream"
+	}
+	return "server_stream"
+}
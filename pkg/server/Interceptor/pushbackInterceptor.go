@@ -0,0 +1,51 @@
+package Interceptors
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"grpctutorial/pkg/retry"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// エラーのRetryInfoをgrpc-retry-pushback-msのトレイラーでも返すUnaryインターセプター
+// gRPCのクライアントはリトライの待ち時間としてこのトレイラーを使う
+// 他のインターセプターのエラーも対象にするためチェーンの一番外側に置く
+func PushbackUnaryServerInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	res, err := handler(ctx, req)
+	if d, ok := retryDelay(err); ok {
+		grpc.SetTrailer(ctx, pushback(d))
+	}
+	return res, err
+}
+
+// Stream版のpushbackインターセプター
+func PushbackStreamServerInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	err := handler(srv, ss)
+	if d, ok := retryDelay(err); ok {
+		ss.SetTrailer(pushback(d))
+	}
+	return err
+}
+
+// エラーのRetryInfoに指定された待ち時間
+func retryDelay(err error) (time.Duration, bool) {
+	if err == nil {
+		return 0, false
+	}
+	for _, d := range status.Convert(err).Details() {
+		if info, ok := d.(*errdetails.RetryInfo); ok {
+			return info.GetRetryDelay().AsDuration(), true
+		}
+	}
+	return 0, false
+}
+
+func pushback(d time.Duration) metadata.MD {
+	return metadata.Pairs(retry.PushbackKey, strconv.FormatInt(d.Milliseconds(), 10))
+}
@@ -0,0 +1,37 @@
+package Interceptors
+
+import (
+	"context"
+
+	"grpctutorial/pkg/ratelimit"
+
+	"google.golang.org/grpc"
+)
+
+// メソッドと呼び出し元毎のトークンバケットで呼び出しを制限するUnaryインターセプター
+// 呼び出し元に認証済みのsubjectを使うため、authインターセプターより後に置く
+func RateLimitUnaryServerInterceptor(l *ratelimit.Limiter) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := l.Allow(ctx, info.FullMethod); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// Stream版のレート制限インターセプター
+// ストリームの開始を制限し、呼び出し元が同時に開けるストリームの数も制限する
+// 数の上限で断ったストリームがトークンを使わないように、先に数を確認する
+func RateLimitStreamServerInterceptor(l *ratelimit.Limiter) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		release, err := l.OpenStream(ss.Context(), info.FullMethod)
+		if err != nil {
+			return err
+		}
+		defer release()
+		if err := l.Allow(ss.Context(), info.FullMethod); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
@@ -0,0 +1,78 @@
+package Interceptors
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"sync/atomic"
+
+	"grpctutorial/pkg/logging"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// これまでに回復したpanicの数
+var panicCount atomic.Int64
+
+// これまでに回復したpanicの数を返す
+func PanicCount() int64 {
+	return panicCount.Load()
+}
+
+// ハンドラのpanicを回復してcodes.Internalを返すUnaryインターセプター
+// 他のインターセプターのpanicも回復できるようにチェーンの先頭に置く
+func RecoveryUnaryServerInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (res interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = recovered(ctx, info.FullMethod, r)
+		}
+	}()
+	return handler(ctx, req)
+}
+
+// Stream版のpanic回復インターセプター
+func RecoveryStreamServerInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = recovered(ss.Context(), info.FullMethod, r)
+		}
+	}()
+	return handler(srv, ss)
+}
+
+// ハンドラの中からgoroutineを起動する
+// goroutineのpanicはインターセプターでは回復できないため、ここで回復してcodes.Internalのエラーとして返す
+// fnの戻り値かpanicから変換したエラーが1つだけ送られる
+func SafeGo(ctx context.Context, fn func() error) <-chan error {
+	errChan := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				method, _ := grpc.Method(ctx)
+				errChan <- recovered(ctx, method, r)
+			}
+		}()
+		errChan <- fn()
+	}()
+	return errChan
+}
+
+// panicの内容とスタックを記録し、呼び出し元に返すエラーを作る
+func recovered(ctx context.Context, method string, r interface{}) error {
+	panicCount.Add(1)
+	addr := "unknown"
+	if p, ok := peer.FromContext(ctx); ok {
+		addr = p.Addr.String()
+	}
+	logging.FromContext(ctx).Error("panic recovered",
+		"method", method,
+		"peer", addr,
+		"panic", fmt.Sprint(r),
+		"stack", string(debug.Stack()),
+	)
+	//panicの内容は内部情報を含むことがあるので呼び出し元には返さない
+	return status.Error(codes.Internal, "internal server error")
+}
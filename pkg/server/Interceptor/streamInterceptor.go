@@ -2,21 +2,24 @@ package Interceptors
 
 import (
 	"errors"
+	"fmt"
 	"io"
-	"log"
+
+	"grpctutorial/pkg/logging"
 
 	"google.golang.org/grpc"
 )
 
 func MyStreamServerInterceptor1(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	l := logging.FromContext(ss.Context())
 	//ここがストリーム処理の前処理
-	log.Println("[pre stream] my stream server interceptor 1:", info.FullMethod)
+	l.Debug("[pre stream] my stream server interceptor 1", "method", info.FullMethod)
 
 	//本来のストリーム処理
 	err := handler(srv, &myServerStreamWrapper1{ss})
 
 	//ストリームがcloseされるときに行われる後処理
-	log.Println("[post stream] my stream server interceptor 1:")
+	l.Debug("[post stream] my stream server interceptor 1")
 	return err
 }
 
@@ -29,8 +32,9 @@ func (s *myServerStreamWrapper1) RecvMsg(m interface{}) error {
 	// ストリームから、リクエストを受信
 	err := s.ServerStream.RecvMsg(m)
 	// 受信したリクエストを、ハンドラで処理する前に差し込む前処理
+	// メッセージの中身は大きいことがあるので型だけ記録する
 	if !errors.Is(err, io.EOF) {
-		log.Println("[pre message] my stream server interceptor 1: ", m)
+		logging.FromContext(s.Context()).Debug("[pre message] my stream server interceptor 1", "message", fmt.Sprintf("%T", m))
 	}
 	return err
 }
@@ -38,6 +42,6 @@ func (s *myServerStreamWrapper1) RecvMsg(m interface{}) error {
 // レスポンスを送信する
 func (s *myServerStreamWrapper1) SendMsg(m interface{}) error {
 	// ハンドラで作成したレスポンスを、ストリームから返信する直前に差し込む後処理
-	log.Println("[post message] my stream server interceptor 1: ", m)
+	logging.FromContext(s.Context()).Debug("[post message] my stream server interceptor 1", "message", fmt.Sprintf("%T", m))
 	return s.ServerStream.SendMsg(m)
 }
@@ -0,0 +1,81 @@
+package Interceptors
+
+import (
+	"context"
+	"sync/atomic"
+
+	"grpctutorial/pkg/tracing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// 受信したtraceparentを親としてRPC毎にserverスパンを作るUnaryインターセプター
+func TracingUnaryServerInterceptor(tracer *tracing.Tracer) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, span := startServerSpan(ctx, tracer, info.FullMethod)
+		tracing.AddMessageEvent(span, tracing.MessageReceived, 1)
+
+		res, err := handler(ctx, req)
+
+		if err == nil {
+			tracing.AddMessageEvent(span, tracing.MessageSent, 1)
+		}
+		tracing.EndWithStatus(span, err)
+		return res, err
+	}
+}
+
+// Stream版のトレーシングインターセプター
+// 送受信したメッセージ毎にイベントを記録する
+func TracingStreamServerInterceptor(tracer *tracing.Tracer) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, span := startServerSpan(ss.Context(), tracer, info.FullMethod)
+
+		err := handler(srv, &tracingServerStream{ServerStream: ss, ctx: ctx, span: span})
+
+		tracing.EndWithStatus(span, err)
+		return err
+	}
+}
+
+func startServerSpan(ctx context.Context, tracer *tracing.Tracer, fullMethod string) (context.Context, *tracing.Span) {
+	name, attrs := tracing.RPCSpan(fullMethod)
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		attrs = append(attrs, tracing.Strings("rpc.grpc.request.metadata_keys", tracing.MetadataKeys(md)))
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		attrs = append(attrs, tracing.String("net.sock.peer.addr", p.Addr.String()))
+	}
+	return tracer.Start(tracing.ExtractIncoming(ctx), name, tracing.KindServer, attrs...)
+}
+
+// スパンを格納したコンテキストを返し、送受信したメッセージを記録するストリーム
+type tracingServerStream struct {
+	grpc.ServerStream
+	ctx      context.Context
+	span     *tracing.Span
+	sent     atomic.Int64
+	received atomic.Int64
+}
+
+func (s *tracingServerStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *tracingServerStream) SendMsg(m interface{}) error {
+	err := s.ServerStream.SendMsg(m)
+	if err == nil {
+		tracing.AddMessageEvent(s.span, tracing.MessageSent, s.sent.Add(1))
+	}
+	return err
+}
+
+func (s *tracingServerStream) RecvMsg(m interface{}) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil {
+		tracing.AddMessageEvent(s.span, tracing.MessageReceived, s.received.Add(1))
+	}
+	return err
+}
@@ -0,0 +1,18 @@
+package Interceptors
+
+import (
+	"context"
+	"fmt"
+
+	"grpctutorial/pkg/logging"
+
+	"google.golang.org/grpc"
+)
+
+func MyUnaryServerInterceptor1(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	l := logging.FromContext(ctx)
+	l.Debug("[pre] my unary server interceptor 1", "method", info.FullMethod)      // ハンドラの前に割り込ませる前処理
+	res, err := handler(ctx, req)                                                  // 本来の処理
+	l.Debug("[post] my unary server interceptor 1", "req", fmt.Sprintf("%T", req)) // ハンドラの後に割り込ませる後処理
+	return res, err
+}
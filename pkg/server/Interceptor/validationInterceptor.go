@@ -0,0 +1,68 @@
+package Interceptors
+
+import (
+	"context"
+	"fmt"
+
+	"grpctutorial/pkg/rpcerr"
+	"grpctutorial/pkg/validate"
+
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+)
+
+// FullMethod毎のルールでリクエストを検証するUnaryインターセプター
+// 違反があればハンドラを呼ばずにInvalidArgumentを返す
+func ValidationUnaryServerInterceptor(policy *validate.Policy) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := validateMessage(policy.Rules(info.FullMethod), req, ""); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// 受信したメッセージを1つずつ検証するStreamインターセプター
+// 違反したメッセージはハンドラに渡さず、RecvMsgがInvalidArgumentを返す
+func ValidationStreamServerInterceptor(policy *validate.Policy) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		rules := policy.Rules(info.FullMethod)
+		if rules == nil {
+			return handler(srv, ss)
+		}
+		return handler(srv, &validationServerStream{ServerStream: ss, rules: rules, indexed: info.IsClientStream && !info.IsServerStream})
+	}
+}
+
+// 受信したメッセージを検証するストリーム
+type validationServerStream struct {
+	grpc.ServerStream
+	rules validate.Rules
+	//client streamingでは違反したフィールドに何番目のリクエストかを示す requests[i]. を付ける
+	indexed bool
+	count   int
+}
+
+func (s *validationServerStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	prefix := ""
+	if s.indexed {
+		prefix = fmt.Sprintf("requests[%d].", s.count)
+	}
+	s.count++
+	return validateMessage(s.rules, m, prefix)
+}
+
+// ルールに違反していればInvalidArgumentを返す
+func validateMessage(rules validate.Rules, m interface{}, prefix string) error {
+	msg, ok := m.(proto.Message)
+	if rules == nil || !ok {
+		return nil
+	}
+	if violations := rules.Validate(msg, prefix); len(violations) > 0 {
+		return rpcerr.InvalidArgument(violations...)
+	}
+	return nil
+}
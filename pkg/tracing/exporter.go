@@ -0,0 +1,213 @@
+package tracing
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// 終了したスパンの出力先
+type Exporter interface {
+	Export(service string, s *Span) error
+	Close() error
+}
+
+// 名前を指定してエクスポーターを作る
+// "stdout" は人が読むための1行JSON、"otlp-file" はpathにOTLP/JSON形式で1行ずつ追記する
+func NewExporter(name, path string) (Exporter, error) {
+	switch name {
+	case "", "none":
+		return nil, nil
+	case "stdout":
+		return &StdoutExporter{w: os.Stdout}, nil
+	case "otlp-file":
+		if path == "" {
+			return nil, fmt.Errorf("otlp-file exporter requires a file path")
+		}
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, err
+		}
+		return &OTLPFileExporter{w: f, c: f}, nil
+	}
+	return nil, fmt.Errorf("unknown trace exporter %q (none, stdout or otlp-file)", name)
+}
+
+// スパンを1行のJSONで書き出す
+type StdoutExporter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (e *StdoutExporter) Export(service string, s *Span) error {
+	attrs, events, status := s.Snapshot()
+	type event struct {
+		Name  string                 `json:"name"`
+		Time  time.Time              `json:"time"`
+		Attrs map[string]interface{} `json:"attributes,omitempty"`
+	}
+	out := struct {
+		Service  string                 `json:"service"`
+		Name     string                 `json:"name"`
+		Kind     string                 `json:"kind"`
+		TraceID  string                 `json:"trace_id"`
+		SpanID   string                 `json:"span_id"`
+		ParentID string                 `json:"parent_span_id,omitempty"`
+		Start    time.Time              `json:"start"`
+		Duration string                 `json:"duration"`
+		Status   Status                 `json:"status"`
+		Attrs    map[string]interface{} `json:"attributes,omitempty"`
+		Events   []event                `json:"events,omitempty"`
+	}{
+		Service:  service,
+		Name:     s.Name,
+		Kind:     s.Kind.String(),
+		TraceID:  s.Context.TraceID.String(),
+		SpanID:   s.Context.SpanID.String(),
+		Start:    s.Start,
+		Duration: s.EndTime.Sub(s.Start).String(),
+		Status:   status,
+		Attrs:    attrMap(attrs),
+	}
+	if s.ParentSpanID != (SpanID{}) {
+		out.ParentID = s.ParentSpanID.String()
+	}
+	for _, ev := range events {
+		out.Events = append(out.Events, event{ev.Name, ev.Time, attrMap(ev.Attrs)})
+	}
+	return e.writeLine(out)
+}
+
+func (e *StdoutExporter) Close() error { return nil }
+
+func (e *StdoutExporter) writeLine(v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	_, err = e.w.Write(append(b, '\n'))
+	return err
+}
+
+func attrMap(attrs []Attr) map[string]interface{} {
+	if len(attrs) == 0 {
+		return nil
+	}
+	m := make(map[string]interface{}, len(attrs))
+	for _, a := range attrs {
+		m[a.Key] = a.Value
+	}
+	return m
+}
+
+// OpenTelemetry CollectorのfileexporterのようにOTLP/JSON形式で1スパン1行ずつ書き出す
+type OTLPFileExporter struct {
+	mu sync.Mutex
+	w  io.Writer
+	c  io.Closer
+}
+
+func (e *OTLPFileExporter) Export(service string, s *Span) error {
+	attrs, events, status := s.Snapshot()
+
+	span := map[string]interface{}{
+		"traceId":           s.Context.TraceID.String(),
+		"spanId":            s.Context.SpanID.String(),
+		"name":              s.Name,
+		"kind":              otlpKind(s.Kind),
+		"startTimeUnixNano": strconv.FormatInt(s.Start.UnixNano(), 10),
+		"endTimeUnixNano":   strconv.FormatInt(s.EndTime.UnixNano(), 10),
+		"attributes":        otlpAttrs(attrs),
+		"status":            otlpStatus(status),
+	}
+	if s.ParentSpanID != (SpanID{}) {
+		span["parentSpanId"] = s.ParentSpanID.String()
+	}
+	otlpEvents := make([]map[string]interface{}, 0, len(events))
+	for _, ev := range events {
+		otlpEvents = append(otlpEvents, map[string]interface{}{
+			"timeUnixNano": strconv.FormatInt(ev.Time.UnixNano(), 10),
+			"name":         ev.Name,
+			"attributes":   otlpAttrs(ev.Attrs),
+		})
+	}
+	span["events"] = otlpEvents
+
+	doc := map[string]interface{}{
+		"resourceSpans": []interface{}{map[string]interface{}{
+			"resource": map[string]interface{}{
+				"attributes": otlpAttrs([]Attr{String("service.name", service)}),
+			},
+			"scopeSpans": []interface{}{map[string]interface{}{
+				"scope": map[string]interface{}{"name": "grpctutorial/pkg/tracing"},
+				"spans": []interface{}{span},
+			}},
+		}},
+	}
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	_, err = e.w.Write(append(b, '\n'))
+	return err
+}
+
+func (e *OTLPFileExporter) Close() error {
+	return e.c.Close()
+}
+
+// OTLPのSpanKind SERVER=2, CLIENT=3
+func otlpKind(k Kind) int {
+	switch k {
+	case KindServer:
+		return 2
+	case KindClient:
+		return 3
+	}
+	return 1
+}
+
+// OTLPのStatusCode OK=1, ERROR=2
+func otlpStatus(s Status) map[string]interface{} {
+	st := map[string]interface{}{"code": 0}
+	switch s.Code {
+	case "OK":
+		st["code"] = 1
+	case "ERROR":
+		st["code"] = 2
+		st["message"] = s.Message
+	}
+	return st
+}
+
+func otlpAttrs(attrs []Attr) []map[string]interface{} {
+	out := make([]map[string]interface{}, 0, len(attrs))
+	for _, a := range attrs {
+		out = append(out, map[string]interface{}{"key": a.Key, "value": otlpValue(a.Value)})
+	}
+	return out
+}
+
+func otlpValue(v interface{}) map[string]interface{} {
+	switch v := v.(type) {
+	case string:
+		return map[string]interface{}{"stringValue": v}
+	case int64:
+		return map[string]interface{}{"intValue": strconv.FormatInt(v, 10)}
+	case []string:
+		values := make([]map[string]interface{}, 0, len(v))
+		for _, s := range v {
+			values = append(values, otlpValue(s))
+		}
+		return map[string]interface{}{"arrayValue": map[string]interface{}{"values": values}}
+	}
+	return map[string]interface{}{"stringValue": fmt.Sprint(v)}
+}
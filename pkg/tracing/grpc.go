@@ -0,0 +1,78 @@
+package tracing
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// 送受信したメッセージのイベント名と種類
+const (
+	MessageEvent    = "message"
+	MessageSent     = "SENT"
+	MessageReceived = "RECEIVED"
+)
+
+// 受信したメタデータのtraceparentをctxに格納する
+func ExtractIncoming(ctx context.Context) context.Context {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ctx
+	}
+	v := md.Get(TraceparentKey)
+	if len(v) == 0 {
+		return ctx
+	}
+	sc, err := ParseTraceparent(v[0])
+	if err != nil {
+		return ctx
+	}
+	return ContextWithRemoteSpanContext(ctx, sc)
+}
+
+// 送信するメタデータにspanのtraceparentを追加する
+func InjectOutgoing(ctx context.Context, s *Span) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, TraceparentKey, s.Context.Traceparent())
+}
+
+// "/myapp.GreetingService/Hello" からスパン名と属性を作る
+func RPCSpan(fullMethod string) (string, []Attr) {
+	name := strings.TrimPrefix(fullMethod, "/")
+	service, method, _ := strings.Cut(name, "/")
+	return name, []Attr{
+		String("rpc.system", "grpc"),
+		String("rpc.service", service),
+		String("rpc.method", method),
+	}
+}
+
+// メタデータのキーを並べて返す
+// 値には認証情報が含まれることがあるので属性にはキーだけ記録する
+func MetadataKeys(md metadata.MD) []string {
+	keys := make([]string, 0, len(md))
+	for k := range md {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// メッセージの送受信をイベントとして記録する
+func AddMessageEvent(s *Span, typ string, id int64) {
+	s.AddEvent(MessageEvent, String("message.type", typ), Int("message.id", id))
+}
+
+// gRPCのステータスを記録してスパンを終了する
+func EndWithStatus(s *Span, err error) {
+	st := status.Convert(err)
+	s.SetAttributes(Int("rpc.grpc.status_code", int64(st.Code())))
+	if err != nil {
+		s.SetStatus("ERROR", st.Code().String()+": "+st.Message())
+	} else {
+		s.SetStatus("OK", "")
+	}
+	s.End()
+}
@@ -0,0 +1,216 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// W3C Trace Contextのメタデータのキー
+const TraceparentKey = "traceparent"
+
+type TraceID [16]byte
+type SpanID [8]byte
+
+func (t TraceID) String() string { return hex.EncodeToString(t[:]) }
+func (s SpanID) String() string  { return hex.EncodeToString(s[:]) }
+
+// 他のプロセスに伝搬するスパンの識別子
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != TraceID{} && sc.SpanID != SpanID{}
+}
+
+// traceparentヘッダーの値 "00-<trace-id>-<span-id>-<flags>" を返す
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return fmt.Sprintf("00-%s-%s-%s", sc.TraceID, sc.SpanID, flags)
+}
+
+// traceparentヘッダーの値を解析する
+func ParseTraceparent(s string) (SpanContext, error) {
+	var sc SpanContext
+	parts := strings.Split(strings.TrimSpace(s), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return sc, errors.New("malformed traceparent")
+	}
+	//version 00 はちょうど4つのフィールドを持つ
+	if parts[0] == "00" && len(parts) != 4 {
+		return sc, errors.New("malformed traceparent")
+	}
+	var version [1]byte
+	if err := decodeHex(version[:], parts[0]); err != nil {
+		return sc, err
+	}
+	if err := decodeHex(sc.TraceID[:], parts[1]); err != nil {
+		return sc, err
+	}
+	if err := decodeHex(sc.SpanID[:], parts[2]); err != nil {
+		return sc, err
+	}
+	var flags [1]byte
+	if err := decodeHex(flags[:], parts[3]); err != nil {
+		return sc, err
+	}
+	sc.Sampled = flags[0]&1 == 1
+	if !sc.IsValid() {
+		return sc, errors.New("traceparent has an all-zero id")
+	}
+	return sc, nil
+}
+
+func decodeHex(dst []byte, s string) error {
+	if len(s) != hex.EncodedLen(len(dst)) || strings.ToLower(s) != s {
+		return fmt.Errorf("malformed traceparent field %q", s)
+	}
+	_, err := hex.Decode(dst, []byte(s))
+	return err
+}
+
+// スパンの種類
+type Kind int
+
+const (
+	KindServer Kind = iota + 1
+	KindClient
+)
+
+func (k Kind) String() string {
+	switch k {
+	case KindServer:
+		return "server"
+	case KindClient:
+		return "client"
+	}
+	return "internal"
+}
+
+// スパンの属性
+type Attr struct {
+	Key   string
+	Value interface{}
+}
+
+func String(key, v string) Attr    { return Attr{key, v} }
+func Int(key string, v int64) Attr { return Attr{key, v} }
+func Strings(key string, v []string) Attr {
+	return Attr{key, append([]string(nil), v...)}
+}
+
+// スパンの中で起きた出来事
+type Event struct {
+	Name  string
+	Time  time.Time
+	Attrs []Attr
+}
+
+// スパンの結果
+type Status struct {
+	//"OK" か "ERROR"
+	Code    string `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+// 1つの処理の記録
+type Span struct {
+	Name         string
+	Kind         Kind
+	Context      SpanContext
+	ParentSpanID SpanID
+	Start        time.Time
+	EndTime      time.Time
+
+	mu     sync.Mutex
+	attrs  []Attr
+	events []Event
+	status Status
+	ended  bool
+	tracer *Tracer
+}
+
+func (s *Span) SetAttributes(attrs ...Attr) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attrs = append(s.attrs, attrs...)
+}
+
+func (s *Span) AddEvent(name string, attrs ...Attr) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, Event{Name: name, Time: time.Now(), Attrs: attrs})
+}
+
+func (s *Span) SetStatus(code, message string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status = Status{Code: code, Message: message}
+}
+
+// スパンを終了してエクスポートする
+// 2回目以降の呼び出しは何もしない
+func (s *Span) End() {
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.EndTime = time.Now()
+	s.mu.Unlock()
+	s.tracer.export(s)
+}
+
+// エクスポート用に属性・イベント・結果を取り出す
+func (s *Span) Snapshot() ([]Attr, []Event, Status) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Attr(nil), s.attrs...), append([]Event(nil), s.events...), s.status
+}
+
+type spanKey struct{}
+type remoteKey struct{}
+
+// ctxに実行中のスパンを格納する
+func ContextWithSpan(ctx context.Context, s *Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, s)
+}
+
+// ctxに格納された実行中のスパンを返す
+func SpanFromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKey{}).(*Span)
+	return s
+}
+
+// 他のプロセスから受け取ったスパンの識別子をctxに格納する
+func ContextWithRemoteSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, remoteKey{}, sc)
+}
+
+func newTraceID() (id TraceID) {
+	randRead(id[:])
+	return id
+}
+
+func newSpanID() (id SpanID) {
+	randRead(id[:])
+	return id
+}
+
+func randRead(b []byte) {
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,78 @@
+package tracing_test
+
+import (
+	"testing"
+
+	"grpctutorial/pkg/tracing"
+)
+
+const (
+	traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	spanID  = "00f067aa0ba902b7"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	tests := []struct {
+		name        string
+		traceparent string
+		wantErr     bool
+		wantSampled bool
+	}{
+		{name: "sampled", traceparent: "00-" + traceID + "-" + spanID + "-01", wantSampled: true},
+		{name: "not sampled", traceparent: "00-" + traceID + "-" + spanID + "-00"},
+		{name: "surrounding spaces", traceparent: " 00-" + traceID + "-" + spanID + "-01 ", wantSampled: true},
+		//将来のversionは後ろにフィールドが増えていても読める
+		{name: "future version with extra fields", traceparent: "01-" + traceID + "-" + spanID + "-01-extra", wantSampled: true},
+		{name: "version ff", traceparent: "ff-" + traceID + "-" + spanID + "-01", wantErr: true},
+		{name: "version not hex", traceparent: "zz-" + traceID + "-" + spanID + "-01", wantErr: true},
+		{name: "version too long", traceparent: "000-" + traceID + "-" + spanID + "-01", wantErr: true},
+		{name: "version 00 with extra fields", traceparent: "00-" + traceID + "-" + spanID + "-01-extra", wantErr: true},
+		{name: "too few fields", traceparent: "00-" + traceID + "-" + spanID, wantErr: true},
+		{name: "all-zero trace id", traceparent: "00-00000000000000000000000000000000-" + spanID + "-01", wantErr: true},
+		{name: "all-zero span id", traceparent: "00-" + traceID + "-0000000000000000-01", wantErr: true},
+		{name: "short trace id", traceparent: "00-" + traceID[2:] + "-" + spanID + "-01", wantErr: true},
+		{name: "long span id", traceparent: "00-" + traceID + "-" + spanID + "00-01", wantErr: true},
+		{name: "short flags", traceparent: "00-" + traceID + "-" + spanID + "-1", wantErr: true},
+		{name: "uppercase hex", traceparent: "00-4BF92F3577B34DA6A3CE929D0E0E4736-" + spanID + "-01", wantErr: true},
+		{name: "not hex", traceparent: "00-" + traceID + "-00f067aa0ba902bz-01", wantErr: true},
+		{name: "empty", traceparent: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sc, err := tracing.ParseTraceparent(tt.traceparent)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParseTraceparent(%q) = %+v, want an error", tt.traceparent, sc)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sc.TraceID.String() != traceID || sc.SpanID.String() != spanID {
+				t.Errorf("ids = %s %s, want %s %s", sc.TraceID, sc.SpanID, traceID, spanID)
+			}
+			if sc.Sampled != tt.wantSampled {
+				t.Errorf("sampled = %t, want %t", sc.Sampled, tt.wantSampled)
+			}
+		})
+	}
+}
+
+// Traceparentで書き出した値は同じSpanContextに読み戻せる
+func TestTraceparentRoundTrip(t *testing.T) {
+	for _, sampled := range []bool{true, false} {
+		want, err := tracing.ParseTraceparent("00-" + traceID + "-" + spanID + "-00")
+		if err != nil {
+			t.Fatal(err)
+		}
+		want.Sampled = sampled
+		got, err := tracing.ParseTraceparent(want.Traceparent())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("round trip of %q = %+v, want %+v", want.Traceparent(), got, want)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package tracing
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// スパンを作成してエクスポーターに渡す
+type Tracer struct {
+	service  string
+	exporter Exporter
+}
+
+// exporterがnilの場合、スパンの伝搬だけ行い記録はしない
+func NewTracer(service string, exporter Exporter) *Tracer {
+	return &Tracer{service: service, exporter: exporter}
+}
+
+func (t *Tracer) Service() string {
+	return t.service
+}
+
+// 新しいスパンを開始し、スパンを格納したコンテキストを返す
+// ctxに実行中のスパンか他のプロセスのスパンの識別子があれば、その子スパンになる
+func (t *Tracer) Start(ctx context.Context, name string, kind Kind, attrs ...Attr) (context.Context, *Span) {
+	s := &Span{
+		Name:   name,
+		Kind:   kind,
+		Start:  time.Now(),
+		attrs:  attrs,
+		tracer: t,
+	}
+
+	var parent SpanContext
+	if p := SpanFromContext(ctx); p != nil {
+		parent = p.Context
+	} else if sc, ok := ctx.Value(remoteKey{}).(SpanContext); ok {
+		parent = sc
+	}
+	if parent.IsValid() {
+		s.Context = SpanContext{TraceID: parent.TraceID, Sampled: parent.Sampled}
+		s.ParentSpanID = parent.SpanID
+	} else {
+		s.Context = SpanContext{TraceID: newTraceID(), Sampled: true}
+	}
+	s.Context.SpanID = newSpanID()
+
+	return ContextWithSpan(ctx, s), s
+}
+
+func (t *Tracer) export(s *Span) {
+	if t.exporter == nil || !s.Context.Sampled {
+		return
+	}
+	if err := t.exporter.Export(t.service, s); err != nil {
+		slog.Warn("failed to export span", "span", s.Name, "error", err)
+	}
+}
+
+// エクスポーターを閉じる
+func (t *Tracer) Close() error {
+	if t.exporter == nil {
+		return nil
+	}
+	return t.exporter.Close()
+}
@@ -0,0 +1,215 @@
+package validate
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// フィールド1つ分の検証ルール
+// 値が0のものは検証しない
+type Rule struct {
+	//空や未設定を許さない
+	Required bool `yaml:"required" json:"required"`
+	//文字列の文字数の範囲
+	MinLength int `yaml:"min_length" json:"min_length"`
+	MaxLength int `yaml:"max_length" json:"max_length"`
+	//使える文字の種類 printable, letters, alnum, ascii のいずれか
+	Charset string `yaml:"charset" json:"charset"`
+	//文字列全体が一致しなければならない正規表現
+	Pattern string `yaml:"pattern" json:"pattern"`
+	//数値の範囲
+	Min *float64 `yaml:"min" json:"min"`
+	Max *float64 `yaml:"max" json:"max"`
+
+	pattern *regexp.Regexp
+}
+
+// 文字の種類
+var charsets = map[string]func(r rune) bool{
+	//制御文字や不正なUTF-8以外
+	"printable": func(r rune) bool { return unicode.IsPrint(r) },
+	//文字・結合文字・空白と、名前に使われる記号
+	"letters": func(r rune) bool {
+		return unicode.IsLetter(r) || unicode.Is(unicode.Mn, r) || r == ' ' || r == '-' || r == '\'' || r == '.'
+	},
+	"alnum": func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) },
+	"ascii": func(r rune) bool { return r >= 0x20 && r < 0x7f },
+}
+
+// フィールドのパスとルールの組
+// キーは "name" や "stream.count" のようにドットで区切ったフィールド名
+type Rules map[string]Rule
+
+// FullMethod毎の検証ルール
+type Policy struct {
+	//キーは "/myapp.GreetingService/Hello" のようなFullMethod
+	//"/myapp.GreetingService/" のように/で終わるキーはサービス全体に一致する
+	Methods map[string]Rules `yaml:"methods" json:"methods"`
+}
+
+// ルールが正しいか確認し、正規表現をコンパイルする
+func (p *Policy) Compile() error {
+	var errs []string
+	for method, rules := range p.Methods {
+		if !strings.HasPrefix(method, "/") {
+			errs = append(errs, fmt.Sprintf("%q must start with /", method))
+		}
+		for field, r := range rules {
+			if err := r.compile(); err != nil {
+				errs = append(errs, fmt.Sprintf("%s %s: %v", method, field, err))
+				continue
+			}
+			rules[field] = r
+		}
+	}
+	if len(errs) > 0 {
+		sort.Strings(errs)
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func (r *Rule) compile() error {
+	if r.Charset != "" {
+		if _, ok := charsets[r.Charset]; !ok {
+			return fmt.Errorf("unknown charset %q (printable, letters, alnum or ascii)", r.Charset)
+		}
+	}
+	if r.MinLength < 0 || r.MaxLength < 0 || (r.MaxLength > 0 && r.MinLength > r.MaxLength) {
+		return fmt.Errorf("invalid length range %d..%d", r.MinLength, r.MaxLength)
+	}
+	if r.Min != nil && r.Max != nil && *r.Min > *r.Max {
+		return fmt.Errorf("invalid range %v..%v", *r.Min, *r.Max)
+	}
+	if r.Pattern != "" {
+		re, err := regexp.Compile(`^(?:` + r.Pattern + `)$`)
+		if err != nil {
+			return err
+		}
+		r.pattern = re
+	}
+	return nil
+}
+
+// FullMethodに一致するルールを返す
+// 完全一致、サービス単位の一致の順に探し、なければnilを返す
+func (p *Policy) Rules(fullMethod string) Rules {
+	if r, ok := p.Methods[fullMethod]; ok {
+		return r
+	}
+	if i := strings.LastIndex(fullMethod, "/"); i > 0 {
+		if r, ok := p.Methods[fullMethod[:i+1]]; ok {
+			return r
+		}
+	}
+	return nil
+}
+
+// メッセージがルールを満たすか確認し、違反を全て返す
+// prefixは違反したフィールドのパスの前に付ける
+func (rs Rules) Validate(m proto.Message, prefix string) []*errdetails.BadRequest_FieldViolation {
+	paths := make([]string, 0, len(rs))
+	for path := range rs {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var violations []*errdetails.BadRequest_FieldViolation
+	for _, path := range paths {
+		if desc := rs[path].check(m.ProtoReflect(), path); desc != "" {
+			violations = append(violations, &errdetails.BadRequest_FieldViolation{Field: prefix + path, Description: desc})
+		}
+	}
+	return violations
+}
+
+// ルールに違反していれば理由を返す
+func (r Rule) check(m protoreflect.Message, path string) string {
+	//途中のメッセージが未設定なら、そのフィールドも未設定として扱う
+	names := strings.Split(path, ".")
+	for _, name := range names[:len(names)-1] {
+		fd := m.Descriptor().Fields().ByName(protoreflect.Name(name))
+		if fd == nil || fd.Kind() != protoreflect.MessageKind || fd.IsList() || fd.IsMap() {
+			return "unknown field"
+		}
+		if !m.Has(fd) {
+			if r.Required {
+				return "is required"
+			}
+			return ""
+		}
+		m = m.Get(fd).Message()
+	}
+	fd := m.Descriptor().Fields().ByName(protoreflect.Name(names[len(names)-1]))
+	if fd == nil {
+		return "unknown field"
+	}
+
+	if !m.Has(fd) {
+		if r.Required && fd.Kind() == protoreflect.StringKind && !fd.IsList() {
+			return "must not be empty"
+		}
+		if r.Required {
+			return "is required"
+		}
+		return ""
+	}
+	if fd.IsList() || fd.IsMap() {
+		return ""
+	}
+	v := m.Get(fd)
+	switch fd.Kind() {
+	case protoreflect.StringKind:
+		return r.checkString(v.String())
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind,
+		protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		return r.checkNumber(float64(v.Int()))
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind, protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return r.checkNumber(float64(v.Uint()))
+	case protoreflect.FloatKind, protoreflect.DoubleKind:
+		return r.checkNumber(v.Float())
+	}
+	return ""
+}
+
+func (r Rule) checkString(s string) string {
+	if !utf8.ValidString(s) {
+		return "must be valid UTF-8"
+	}
+	n := utf8.RuneCountInString(s)
+	if r.MinLength > 0 && n < r.MinLength {
+		return fmt.Sprintf("must be at least %d characters, got %d", r.MinLength, n)
+	}
+	if r.MaxLength > 0 && n > r.MaxLength {
+		return fmt.Sprintf("must be at most %d characters, got %d", r.MaxLength, n)
+	}
+	if allowed := charsets[r.Charset]; allowed != nil {
+		for i, c := range s {
+			if !allowed(c) {
+				return fmt.Sprintf("contains a character not allowed in %s at byte %d: %U", r.Charset, i, c)
+			}
+		}
+	}
+	if r.pattern != nil && !r.pattern.MatchString(s) {
+		return fmt.Sprintf("must match %q", r.Pattern)
+	}
+	return ""
+}
+
+func (r Rule) checkNumber(v float64) string {
+	if r.Min != nil && v < *r.Min {
+		return fmt.Sprintf("must be at least %v, got %v", *r.Min, v)
+	}
+	if r.Max != nil && v > *r.Max {
+		return fmt.Sprintf("must be at most %v, got %v", *r.Max, v)
+	}
+	return ""
+}